@@ -0,0 +1,171 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/backup"
+	"github.com/NicholasRucinski/commentasaurus/internal/search"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	org := fs.String("org", "", "GitHub organisation or user that owns the repo (required)")
+	repo := fs.String("repo", "", "repository the comments live in (required)")
+	category := fs.String("category", "General", "discussion category holding the comments")
+	out := fs.String("o", "", "archive to write; gzipped when it ends in .gz or .tgz (required)")
+	fs.Parse(args)
+
+	if *org == "" || *repo == "" || *out == "" {
+		fs.Usage()
+		return errors.New("-org, -repo and -o are required")
+	}
+
+	token, err := githubToken()
+	if err != nil {
+		return err
+	}
+
+	client := githubClient()
+	categoryID, err := utils.FindOrCreateCommentsCategory(client, token, *org, *repo, *category)
+	if err != nil {
+		return err
+	}
+	discussions, err := utils.ListPageDiscussions(client, token, *org, *repo, categoryID)
+	if err != nil {
+		return err
+	}
+
+	archive := backup.New(*org, *repo, *category, discussions)
+
+	// Write to a temporary file first so a failed run never replaces a
+	// good backup with a partial one.
+	tmp := *out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	compress := strings.HasSuffix(*out, ".gz") || strings.HasSuffix(*out, ".tgz")
+	if err := archive.Write(f, compress); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Backed up %d comments on %d pages to %s\n", archive.Manifest.Comments, archive.Manifest.Pages, *out)
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("i", "", "archive written by backup (required)")
+	org := fs.String("org", "", "organisation to restore into (default: the one backed up)")
+	repo := fs.String("repo", "", "repository to restore into (default: the one backed up)")
+	category := fs.String("category", "", "discussion category to restore into (default: the one backed up)")
+	onConflict := fs.String("on-conflict", "skip", "what to do with comments that already exist: skip, fail or duplicate")
+	dbPath := fs.String("store", "", "restore into the search index of this database instead of GitHub")
+	dryRun := fs.Bool("dry-run", false, "print what would be restored without changing anything")
+	fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		return errors.New("-i is required")
+	}
+
+	conflict := backup.Conflict(*onConflict)
+	if conflict != backup.ConflictSkip && conflict != backup.ConflictFail && conflict != backup.ConflictDuplicate {
+		return fmt.Errorf("unknown -on-conflict %q", *onConflict)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	archive, err := backup.Read(f)
+	if err != nil {
+		return err
+	}
+	m := archive.Manifest
+	fmt.Fprintf(os.Stderr, "Backup of %s/%s from %s: %d comments on %d pages\n", m.Org, m.Repo, m.CreatedAt.Format("2006-01-02 15:04 MST"), m.Comments, m.Pages)
+
+	targetOrg := cmp.Or(*org, m.Org)
+	targetRepo := cmp.Or(*repo, m.Repo)
+
+	if *dbPath != "" {
+		return restoreToStore(archive, *dbPath, targetOrg, targetRepo, *dryRun)
+	}
+
+	token, err := githubToken()
+	if err != nil {
+		return err
+	}
+
+	client := githubClient()
+	categoryID, err := utils.FindOrCreateCommentsCategory(client, token, targetOrg, targetRepo, cmp.Or(*category, m.Category))
+	if err != nil {
+		return err
+	}
+	repoID, err := utils.GetRepositoryID(client, token, targetOrg, targetRepo)
+	if err != nil {
+		return err
+	}
+
+	rs := &backup.Restorer{
+		Client:     client,
+		Token:      token,
+		Org:        targetOrg,
+		Repo:       targetRepo,
+		CategoryID: categoryID,
+		RepoID:     repoID,
+	}
+	res, err := rs.Restore(archive, backup.RestoreOptions{OnConflict: conflict, DryRun: *dryRun, Log: os.Stderr})
+	if err != nil {
+		return err
+	}
+
+	verb := "Restored"
+	if *dryRun {
+		verb = "Would restore"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d comments on %d pages to %s/%s (%d already present)\n", verb, res.Restored, res.Pages, targetOrg, targetRepo, res.Skipped)
+	return nil
+}
+
+// restoreToStore loads the archive into a local search index, which is
+// useful for searching a repo whose discussions are gone.
+func restoreToStore(archive backup.Archive, dbPath, org, repo string, dryRun bool) error {
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "Would index %d comments into %s\n", archive.Manifest.Comments, dbPath)
+		return nil
+	}
+
+	st, err := store.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	ix := &search.Indexer{Store: st}
+	for _, p := range archive.Pages {
+		if err := ix.IndexComments(org, repo, p.Comments); err != nil {
+			return fmt.Errorf("indexing %s: %w", p.Page, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Indexed %d comments into %s\n", archive.Manifest.Comments, dbPath)
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/export"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	org := fs.String("org", "", "GitHub organisation or user that owns the repo (required)")
+	repo := fs.String("repo", "", "repository the comments live in (required)")
+	category := fs.String("category", "General", "discussion category holding the comments")
+	formatName := fs.String("format", "csv", "output format: csv, jsonl or markdown")
+	page := fs.String("page", "", "only export this page")
+	since := fs.String("since", "", "only export comments created on or after this date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "only export comments created on or before this date (YYYY-MM-DD or RFC 3339)")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+
+	if *org == "" || *repo == "" {
+		fs.Usage()
+		return errors.New("-org and -repo are required")
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	filter := export.Filter{Page: *page}
+	if *since != "" {
+		if filter.Since, err = export.ParseDate(*since, false); err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = export.ParseDate(*until, true); err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+
+	token, err := githubToken()
+	if err != nil {
+		return err
+	}
+
+	client := githubClient()
+	categoryID, err := utils.FindOrCreateCommentsCategory(client, token, *org, *repo, *category)
+	if err != nil {
+		return err
+	}
+	discussions, err := utils.ListPageDiscussions(client, token, *org, *repo, categoryID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	records := export.Records(discussions, filter)
+	if err := export.Write(w, format, *org, *repo, records); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d comments to %s\n", len(records), *out)
+	}
+	return nil
+}
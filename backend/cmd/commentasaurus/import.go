@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/importer"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	source := fs.String("source", "", "system to import from: giscus or utterances (required)")
+	org := fs.String("org", "", "GitHub organisation or user that owns the target repo (required)")
+	repo := fs.String("repo", "", "repository to import comments into (required)")
+	category := fs.String("category", "General", "discussion category holding Commentasaurus comments")
+	from := fs.String("from", "", "owner/repo holding the old threads (default: the target repo)")
+	sourceCategory := fs.String("source-category", "Announcements", "giscus: discussion category holding the old threads")
+	issueAuthor := fs.String("issue-author", "utterances-bot", "utterances: only import issues opened by this login (empty for any)")
+	label := fs.String("label", "", "utterances: only import issues with this label")
+	mapping := fs.String("mapping", "pathname", "how the old threads were titled: pathname, url or title")
+	mapFile := fs.String("map", "", "JSON file mapping thread titles to page paths, required for -mapping title")
+	rewrite := fs.Bool("rewrite", false, "giscus: convert discussions in place, keeping the original authors")
+	resolve := fs.Bool("resolve", false, "mark imported threads resolved")
+	dryRun := fs.Bool("dry-run", false, "print what would be imported without changing anything")
+	fs.Parse(args)
+
+	if *source == "" || *org == "" || *repo == "" {
+		fs.Usage()
+		return errors.New("-source, -org and -repo are required")
+	}
+
+	opts := importer.Options{
+		Source:  importer.Source(*source),
+		Mapping: importer.Mapping(*mapping),
+		Rewrite: *rewrite,
+		Resolve: *resolve,
+		DryRun:  *dryRun,
+		Log:     os.Stderr,
+	}
+	if opts.Source != importer.Giscus && opts.Source != importer.Utterances {
+		return fmt.Errorf("unknown source %q", *source)
+	}
+	if opts.Mapping != importer.MappingPathname && opts.Mapping != importer.MappingURL && opts.Mapping != importer.MappingTitle {
+		return fmt.Errorf("unknown mapping %q", *mapping)
+	}
+	if *mapFile != "" {
+		data, err := os.ReadFile(*mapFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &opts.Titles); err != nil {
+			return fmt.Errorf("reading %s: %w", *mapFile, err)
+		}
+	} else if opts.Mapping == importer.MappingTitle {
+		return errors.New("-mapping title needs a -map file")
+	}
+
+	fromOwner, fromRepo := *org, *repo
+	if *from != "" {
+		var ok bool
+		fromOwner, fromRepo, ok = strings.Cut(*from, "/")
+		if !ok {
+			return fmt.Errorf("-from must be owner/repo, got %q", *from)
+		}
+	}
+	if opts.Rewrite && (fromOwner != *org || fromRepo != *repo) {
+		return errors.New("-rewrite only works when the old threads are in the target repo")
+	}
+
+	token, err := githubToken()
+	if err != nil {
+		return err
+	}
+	client := githubClient()
+
+	var threads []utils.ExternalThread
+	switch opts.Source {
+	case importer.Giscus:
+		categoryID, err := utils.FindOrCreateCommentsCategory(client, token, fromOwner, fromRepo, *sourceCategory)
+		if err != nil {
+			return err
+		}
+		threads, err = utils.ListDiscussionThreads(client, token, fromOwner, fromRepo, categoryID)
+		if err != nil {
+			return err
+		}
+	case importer.Utterances:
+		threads, err = utils.ListIssueThreads(client, token, fromOwner, fromRepo, *issueAuthor, *label)
+		if err != nil {
+			return err
+		}
+	}
+
+	categoryID, err := utils.FindOrCreateCommentsCategory(client, token, *org, *repo, *category)
+	if err != nil {
+		return err
+	}
+	repoID, err := utils.GetRepositoryID(client, token, *org, *repo)
+	if err != nil {
+		return err
+	}
+
+	im := &importer.Importer{
+		Client:     client,
+		Token:      token,
+		Org:        *org,
+		Repo:       *repo,
+		CategoryID: categoryID,
+		RepoID:     repoID,
+	}
+	res, err := im.Run(threads, opts)
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if opts.DryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d comments from %d threads (%d already imported, %d resolved, %d unmapped)\n",
+		verb, res.Imported, res.Threads, res.Skipped, res.Resolved, len(res.Unmapped))
+	return nil
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
 	"github.com/NicholasRucinski/commentasaurus/internal/routes"
+	"github.com/NicholasRucinski/commentasaurus/internal/server"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
 	"github.com/joho/godotenv"
 )
 
@@ -17,26 +25,67 @@ func main() {
 		log.Println("No .env file found or error loading it")
 	}
 
-	handler := routes.RegisterRoutes()
+	cfg, err := parseArgs()
+	if err != nil {
+		exit(err)
+	}
+
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		exit(fmt.Errorf("Failed to open database: %w", err))
+	}
+	defer st.Close()
+
+	// Workers keep running while requests drain, so events from the last
+	// comment writes are still delivered.
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	handler, disconnect, err := routes.RegisterRoutes(workers, st, cfg)
+	if err != nil {
+		exit(err)
+	}
 
-	server := http.Server{
-		Addr:    ":8080",
-		Handler: handler,
+	srv, err := server.New(cfg, handler)
+	if err != nil {
+		exit(err)
 	}
+	srv.RegisterOnShutdown(disconnect)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fmt.Println("Server listening on port :8080")
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	slog.Info("server listening", "addr", cfg.Addr(), "tls", srv.TLSConfig != nil)
+	if err := server.Run(ctx, srv, cfg); err != nil {
+		exit(fmt.Errorf("Server failed: %w", err))
 	}
+	slog.Info("server stopped")
 }
 
-func parseArgs() {
+// parseArgs loads the config, adding -log to its flags, and sets up JSON
+// logging to stderr.
+func parseArgs() (*config.Config, error) {
 	logsEnabled := flag.Bool("log", false, "Enable error logging")
-	flag.Parse()
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
 
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	var out io.Writer = os.Stderr
 	if !*logsEnabled {
-		log.SetOutput(io.Discard)
+		out = io.Discard
 	}
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logging.Setup(out, level)
+	return cfg, nil
+}
 
+// exit reports an error that stops the server. It is printed even without
+// -log.
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,139 @@
+// Package admin serves the /admin API for managing sites, comments, bans,
+// webhooks and secrets without going through GitHub.
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const ownerTTL = 5 * time.Minute
+
+type Handler struct {
+	Store    *store.Store
+	Sites    *sites.Registry
+	Events   *events.Broker
+	Audit    *audit.Log
+	Sessions *auth.Sessions
+	// GitHubToken checks org ownership and acts on comments for admins.
+	GitHubToken string
+
+	mu     sync.Mutex
+	owners map[ownerKey]ownerEntry
+}
+
+// Actor is the signed-in user making an admin request. Global admins are
+// listed in admin_users and may manage everything; anyone else may only
+// manage orgs they own on GitHub.
+type Actor struct {
+	*user.User
+	Global bool
+}
+
+type ownerKey struct {
+	login, org string
+}
+
+type ownerEntry struct {
+	owner     bool
+	checkedAt time.Time
+}
+
+type actionFunc func(w http.ResponseWriter, r *http.Request, actor *Actor)
+
+// Register adds the /admin routes to router. Every route needs a session;
+// each one then checks the actor may manage what it touches.
+func (h *Handler) Register(router *http.ServeMux) {
+	router.HandleFunc("GET /admin/sites", h.guard(h.ListSites))
+	router.HandleFunc("PUT /admin/sites/{id}", h.guard(h.PutSite))
+	router.HandleFunc("DELETE /admin/sites/{id}", h.guard(h.DeleteSite))
+	router.HandleFunc("PUT /admin/sites/{id}/permission", h.guard(h.SetPermission))
+	router.HandleFunc("DELETE /admin/sites/{id}/permission", h.guard(h.ClearPermission))
+
+	router.HandleFunc("POST /admin/repos/{org}/{repo}/comments/{id}/resolve", h.guard(h.ResolveComment))
+	router.HandleFunc("DELETE /admin/repos/{org}/{repo}/comments/{id}", h.guard(h.DeleteComment))
+
+	router.HandleFunc("GET /admin/bans", h.guard(h.ListBans))
+	router.HandleFunc("POST /admin/bans", h.guard(h.Ban))
+	router.HandleFunc("DELETE /admin/bans/{login}", h.guard(h.Unban))
+
+	router.HandleFunc("GET /admin/webhooks", h.guard(h.ListWebhooks))
+	router.HandleFunc("POST /admin/webhooks", h.guard(h.CreateWebhook))
+	router.HandleFunc("DELETE /admin/webhooks/{id}", h.guard(h.DeleteWebhook))
+	router.HandleFunc("GET /admin/webhooks/{id}/deliveries", h.guard(h.WebhookDeliveries))
+	router.HandleFunc("POST /admin/webhooks/{id}/deliveries/{delivery}/redeliver", h.guard(h.RedeliverWebhook))
+	router.HandleFunc("POST /admin/webhooks/{id}/rotate-secret", h.guard(h.RotateWebhookSecret))
+
+	router.HandleFunc("GET /admin/audit", h.guard(h.ListAudit))
+}
+
+func (h *Handler) guard(next actionFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewer, err := h.Sessions.User(r)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r, &Actor{User: viewer, Global: h.Sessions.IsAdmin(viewer)})
+	}
+}
+
+// canManage reports whether actor may manage org, writing a 403 if not. Only
+// global admins may manage things that belong to no org.
+func (h *Handler) canManage(w http.ResponseWriter, r *http.Request, actor *Actor, org string) bool {
+	if actor.Global {
+		return true
+	}
+	if org == "" || !h.isOwner(r.Context(), actor.Login, org) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) isOwner(ctx context.Context, login, org string) bool {
+	key := ownerKey{strings.ToLower(login), strings.ToLower(org)}
+
+	h.mu.Lock()
+	entry, ok := h.owners[key]
+	h.mu.Unlock()
+	fresh := ok && time.Since(entry.checkedAt) < ownerTTL
+	metrics.CacheLookup("org_owner", fresh)
+	if fresh {
+		return entry.owner
+	}
+
+	owner, err := utils.IsOrgOwner(logging.Client(ctx), h.GitHubToken, org, login)
+	if err != nil {
+		slog.Warn("admin: checking org ownership failed", "login", login, "org", org, "err", err)
+		return false
+	}
+
+	h.mu.Lock()
+	if h.owners == nil {
+		h.owners = map[ownerKey]ownerEntry{}
+	}
+	h.owners[key] = ownerEntry{owner: owner, checkedAt: time.Now()}
+	h.mu.Unlock()
+	return owner
+}
+
+// record adds an admin action to the audit log.
+func (h *Handler) record(r *http.Request, actor *Actor, e audit.Entry) {
+	e.Actor = actor.Login
+	h.Audit.Record(r, e)
+}
@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type ListAuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+	// NextCursor is passed back as ?cursor= for older entries.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ListAudit searches the audit log, newest first. It filters on actor,
+// action, target, org, repo, since and until (RFC 3339) and pages with limit
+// and cursor. Org owners must name their org.
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	q := r.URL.Query()
+	if !h.canManage(w, r, actor, q.Get("org")) {
+		return
+	}
+	if h.Audit == nil {
+		http.Error(w, "audit log is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := audit.Query{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Org:    q.Get("org"),
+		Repo:   q.Get("repo"),
+		Limit:  defaultAuditLimit,
+	}
+
+	var err error
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		query.Limit, err = strconv.Atoi(v)
+		if err != nil || query.Limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		query.Limit = min(query.Limit, maxAuditLimit)
+	}
+	if v := q.Get("cursor"); v != "" {
+		query.BeforeID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || query.BeforeID < 1 {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := h.Audit.Query(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query audit log", "err", err)
+		http.Error(w, "failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ListAuditResponse{Entries: entries}
+	if len(entries) == query.Limit {
+		resp.NextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
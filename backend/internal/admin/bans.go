@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+type BanRequest struct {
+	Login  string `json:"login"`
+	Org    string `json:"org"`
+	Reason string `json:"reason"`
+}
+
+// ListBans lists bans, narrowed to one org with ?org=. Org owners must name
+// their org.
+func (h *Handler) ListBans(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	org := r.URL.Query().Get("org")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	bans, err := h.Store.Bans(org)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list bans", "org", org, "err", err)
+		http.Error(w, "failed to list bans", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// Ban stops a user commenting in an org, or everywhere when org is empty.
+func (h *Handler) Ban(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Login == "" {
+		http.Error(w, "login is required", http.StatusBadRequest)
+		return
+	}
+	if !h.canManage(w, r, actor, req.Org) {
+		return
+	}
+
+	ban, err := h.Store.Ban(store.Ban{Login: req.Login, Org: req.Org, Reason: req.Reason, BannedBy: actor.Login})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to ban user", "login", req.Login, "org", req.Org, "err", err)
+		http.Error(w, "failed to ban user", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{Action: "user.ban", Target: req.Login, Org: req.Org, AfterHash: audit.Hash(ban)})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (h *Handler) Unban(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	login := r.PathValue("login")
+	org := r.URL.Query().Get("org")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	err := h.Store.Unban(login, org)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "ban not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unban user", "login", login, "org", org, "err", err)
+		http.Error(w, "failed to unban user", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{Action: "user.unban", Target: login, Org: org})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// ResolveComment resolves any comment in the repo, using the server's token
+// so it works whoever wrote it.
+func (h *Handler) ResolveComment(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	org, repo, id := r.PathValue("org"), r.PathValue("repo"), r.PathValue("id")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	client := logging.Client(r.Context())
+	githubToken := h.GitHubToken
+
+	loc, ok := locate(w, client, githubToken, org, repo, id)
+	if !ok {
+		return
+	}
+
+	var change audit.Change
+	comment, err := utils.ModifyComment(client, githubToken, id, loc.Page, change.Track(utils.MarkResolved))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve comment", "comment", id, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{
+		Action:     "comment.resolve",
+		Target:     id,
+		Org:        org,
+		Repo:       repo,
+		Page:       loc.Page,
+		BeforeHash: change.Before,
+		AfterHash:  change.After,
+	})
+	h.publish(events.Resolved, org, repo, loc.Page, actor.Login, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteComment deletes any comment in the repo, along with its replies.
+func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	org, repo, id := r.PathValue("org"), r.PathValue("repo"), r.PathValue("id")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	client := logging.Client(r.Context())
+	githubToken := h.GitHubToken
+
+	loc, ok := locate(w, client, githubToken, org, repo, id)
+	if !ok {
+		return
+	}
+
+	if err := utils.DeleteComment(client, githubToken, id); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete comment", "comment", id, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{Action: "comment.delete", Target: id, Org: org, Repo: repo, Page: loc.Page})
+	h.publish(events.Deleted, org, repo, loc.Page, actor.Login, utils.Comment{ID: id, Page: loc.Page})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// locate checks the comment is in org/repo, so owning one org doesn't let
+// anyone touch comments elsewhere through the server's token.
+func locate(w http.ResponseWriter, client *http.Client, githubToken, org, repo, id string) (utils.CommentLocation, bool) {
+	loc, err := utils.LocateComment(client, githubToken, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return loc, false
+	}
+	if !strings.EqualFold(loc.Owner, org) || !strings.EqualFold(loc.Repo, repo) {
+		http.Error(w, "comment not found in "+org+"/"+repo, http.StatusNotFound)
+		return loc, false
+	}
+	return loc, true
+}
+
+func (h *Handler) publish(eventType events.Type, org, repo, page, actor string, comment utils.Comment) {
+	if h.Events == nil {
+		return
+	}
+	h.Events.Publish(events.Event{
+		Type:    eventType,
+		Org:     org,
+		Repo:    repo,
+		Page:    page,
+		Actor:   actor,
+		Comment: comment,
+	})
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+)
+
+// RotateWebhookSecret gives an outgoing webhook a new signing secret and
+// returns it. This is the only time the new secret is shown.
+func (h *Handler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	hook, ok := h.webhook(w, r, actor)
+	if !ok {
+		return
+	}
+
+	before := audit.Hash(hook.Secret)
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	hook.Secret = hex.EncodeToString(secret)
+
+	if err := h.Store.SetWebhookSecret(hook.ID, hook.Secret); err != nil {
+		slog.ErrorContext(r.Context(), "failed to rotate webhook secret", "webhook", hook.ID, "err", err)
+		http.Error(w, "failed to rotate secret", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{
+		Action:     "webhook.rotate-secret",
+		Target:     strconv.FormatInt(hook.ID, 10),
+		Org:        hook.Org,
+		Repo:       hook.Repo,
+		BeforeHash: before,
+		AfterHash:  audit.Hash(hook.Secret),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
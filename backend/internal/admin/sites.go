@@ -0,0 +1,194 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+type PutSiteRequest struct {
+	Org             string   `json:"org"`
+	Repo            string   `json:"repo"`
+	CategoryName    string   `json:"categoryName"`
+	CategoryID      string   `json:"categoryId"`
+	RepoID          string   `json:"repoId"`
+	PermissionLevel string   `json:"permissionLevel"`
+	AllowedOrigins  []string `json:"allowedOrigins"`
+	CookieDomain    string   `json:"cookieDomain"`
+}
+
+type PermissionRequest struct {
+	PermissionLevel string `json:"permissionLevel"`
+}
+
+// ListSites lists registered sites, narrowed to one org with ?org=. Org
+// owners must name their org.
+func (h *Handler) ListSites(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	org := r.URL.Query().Get("org")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	entries := []sites.Entry{}
+	for _, e := range h.Sites.List() {
+		if org == "" || strings.EqualFold(e.Org, org) {
+			entries = append(entries, e)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// PutSite registers the site named in the path, or replaces it.
+func (h *Handler) PutSite(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	var req PutSiteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	site := store.Site{
+		ID:              r.PathValue("id"),
+		Org:             req.Org,
+		Repo:            req.Repo,
+		CategoryName:    req.CategoryName,
+		CategoryID:      req.CategoryID,
+		RepoID:          req.RepoID,
+		PermissionLevel: req.PermissionLevel,
+		AllowedOrigins:  req.AllowedOrigins,
+		CookieDomain:    req.CookieDomain,
+		UpdatedBy:       actor.Login,
+	}
+	if err := sites.Validate(site); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.canManage(w, r, actor, site.Org) {
+		return
+	}
+	var before string
+	if existing, ok := h.Sites.Get(site.ID); ok {
+		if !h.canManage(w, r, actor, existing.Org) {
+			return
+		}
+		before = audit.Hash(existing)
+	}
+
+	e, err := h.Sites.Put(site)
+	if errors.Is(err, sites.ErrReadOnly) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to save site", "site", site.ID, "err", err)
+		http.Error(w, "failed to save site", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, siteEntry("site.put", e, before, audit.Hash(e)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *Handler) DeleteSite(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	id := r.PathValue("id")
+	existing, ok := h.Sites.Get(id)
+	if !ok {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if !h.canManage(w, r, actor, existing.Org) {
+		return
+	}
+
+	err := h.Sites.Delete(id)
+	switch {
+	case errors.Is(err, sites.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to delete site", "site", id, "err", err)
+		http.Error(w, "failed to delete site", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, siteEntry("site.delete", existing, audit.Hash(existing), ""))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetPermission overrides a site's permission level. It works for sites from
+// the config file too.
+func (h *Handler) SetPermission(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	id := r.PathValue("id")
+	existing, ok := h.Sites.Get(id)
+	if !ok {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if !h.canManage(w, r, actor, existing.Org) {
+		return
+	}
+
+	var req PermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	e, err := h.Sites.SetPermission(id, req.PermissionLevel, actor.Login)
+	if err != nil {
+		if errors.Is(err, sites.ErrUnknownSite) {
+			http.Error(w, "site not found", http.StatusNotFound)
+			return
+		}
+		slog.WarnContext(r.Context(), "failed to override site permission", "site", id, "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.record(r, actor, siteEntry("site.permission", e, audit.Hash(existing), audit.Hash(e)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// ClearPermission removes an override, going back to the site's own level.
+func (h *Handler) ClearPermission(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	id := r.PathValue("id")
+	existing, ok := h.Sites.Get(id)
+	if !ok {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if !h.canManage(w, r, actor, existing.Org) {
+		return
+	}
+
+	e, err := h.Sites.ClearPermission(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to clear site permission override", "site", id, "err", err)
+		http.Error(w, "failed to clear override", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, siteEntry("site.permission.clear", e, audit.Hash(existing), audit.Hash(e)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func siteEntry(action string, site sites.Entry, before, after string) audit.Entry {
+	return audit.Entry{
+		Action:     action,
+		Target:     site.ID,
+		Org:        site.Org,
+		Repo:       site.Repo,
+		BeforeHash: before,
+		AfterHash:  after,
+	}
+}
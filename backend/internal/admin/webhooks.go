@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/webhooks"
+)
+
+type CreateWebhookRequest struct {
+	Org    string   `json:"org"`
+	Repo   string   `json:"repo"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Org == "" || req.Repo == "" {
+		http.Error(w, "org and repo are required", http.StatusBadRequest)
+		return
+	}
+	if !h.canManage(w, r, actor, req.Org) {
+		return
+	}
+	if err := webhooks.CheckURL(r.Context(), req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	known := make([]string, 0, len(webhooks.EventNames))
+	for _, name := range webhooks.EventNames {
+		known = append(known, name)
+	}
+	if len(req.Events) == 0 {
+		req.Events = known
+	}
+	for _, name := range req.Events {
+		if !slices.Contains(known, name) {
+			http.Error(w, "unknown event "+name, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	hook, err := h.Store.CreateWebhook(store.Webhook{
+		Org:       req.Org,
+		Repo:      req.Repo,
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    req.Events,
+		CreatedBy: actor.Login,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create webhook", "err", err)
+		http.Error(w, "failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{
+		Action:    "webhook.create",
+		Target:    strconv.FormatInt(hook.ID, 10),
+		Org:       hook.Org,
+		Repo:      hook.Repo,
+		AfterHash: audit.Hash(hook),
+	})
+
+	// The secret is only ever returned here and by RotateWebhookSecret.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// ListWebhooks lists webhooks, narrowed with ?org= and ?repo=. Org owners
+// must name their org.
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	org := r.URL.Query().Get("org")
+	if !h.canManage(w, r, actor, org) {
+		return
+	}
+
+	hooks, err := h.Store.Webhooks(org, r.URL.Query().Get("repo"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list webhooks", "err", err)
+		http.Error(w, "failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	hook, ok := h.webhook(w, r, actor)
+	if !ok {
+		return
+	}
+
+	if err := h.Store.DeleteWebhook(hook.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete webhook", "webhook", hook.ID, "err", err)
+		http.Error(w, "failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{
+		Action:     "webhook.delete",
+		Target:     strconv.FormatInt(hook.ID, 10),
+		Org:        hook.Org,
+		Repo:       hook.Repo,
+		BeforeHash: audit.Hash(hook),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveries is the delivery log. ?status=dead lists the dead-letter
+// queue.
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	hook, ok := h.webhook(w, r, actor)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	deliveries, err := h.Store.Deliveries(hook.ID, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list deliveries", "webhook", hook.ID, "err", err)
+		http.Error(w, "failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request, actor *Actor) {
+	hook, ok := h.webhook(w, r, actor)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.Store.GetDelivery(deliveryID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && delivery.WebhookID != hook.ID) {
+		http.Error(w, "delivery not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = h.Store.RequeueDelivery(deliveryID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to requeue delivery", "delivery", deliveryID, "err", err)
+		http.Error(w, "failed to requeue delivery", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, actor, audit.Entry{
+		Action: "webhook.redeliver",
+		Target: strconv.FormatInt(deliveryID, 10),
+		Org:    hook.Org,
+		Repo:   hook.Repo,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// webhook loads the webhook named by the {id} path value, writing an error
+// unless it exists and actor may manage its org.
+func (h *Handler) webhook(w http.ResponseWriter, r *http.Request, actor *Actor) (store.Webhook, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return store.Webhook{}, false
+	}
+
+	hook, err := h.Store.GetWebhook(id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return store.Webhook{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load webhook", "webhook", id, "err", err)
+		http.Error(w, "failed to load webhook", http.StatusInternalServerError)
+		return store.Webhook{}, false
+	}
+	if !h.canManage(w, r, actor, hook.Org) {
+		return store.Webhook{}, false
+	}
+	return hook, true
+}
@@ -0,0 +1,132 @@
+// Package audit keeps an append-only record of who changed what: comments
+// created, edited, resolved or deleted and every admin action.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+const pruneInterval = 24 * time.Hour
+
+type (
+	Entry = store.AuditEntry
+	Query = store.AuditQuery
+)
+
+// Sink stores entries. Entries are never changed once appended; Prune is the
+// only way they go away.
+type Sink interface {
+	Append(e Entry) (Entry, error)
+	Query(q Query) ([]Entry, error)
+	Prune(cutoff time.Time) (int64, error)
+}
+
+type Log struct {
+	Sink Sink
+	// Retention is how long entries are kept. Zero keeps them forever.
+	Retention time.Duration
+}
+
+// Open builds the log described by cfg, writing to st or to a file.
+func Open(cfg config.Audit, st *store.Store) (*Log, error) {
+	l := &Log{Retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour}
+	switch cfg.Sink {
+	case "", "sql":
+		if err := st.SetAuditRetention(cfg.RetentionDays); err != nil {
+			return nil, fmt.Errorf("audit: setting retention: %w", err)
+		}
+		l.Sink = &SQLSink{Store: st}
+	case "file":
+		sink, err := OpenFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		l.Sink = sink
+	default:
+		return nil, fmt.Errorf("audit: unknown sink %q", cfg.Sink)
+	}
+	return l, nil
+}
+
+// Record appends e, filling in the time and where the request came from.
+// Failures are logged: the action itself has already happened.
+func (l *Log) Record(r *http.Request, e Entry) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.IP = logging.ClientIP(r)
+	e.UserAgent = r.UserAgent()
+	if _, err := l.Sink.Append(e); err != nil {
+		slog.ErrorContext(r.Context(), "audit: recording entry failed", "action", e.Action, "target", e.Target, "actor", e.Actor, "err", err)
+	}
+}
+
+func (l *Log) Query(q Query) ([]Entry, error) {
+	return l.Sink.Query(q)
+}
+
+// Run prunes entries past the retention period once a day until ctx is
+// cancelled.
+func (l *Log) Run(ctx context.Context) {
+	if l.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := l.Sink.Prune(time.Now().Add(-l.Retention)); err != nil {
+			slog.Error("audit: pruning failed", "err", err)
+		} else if n > 0 {
+			slog.Info("audit: pruned old entries", "count", n, "retention", l.Retention.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Hash fingerprints v as JSON so two states can be compared without the log
+// holding their content. It returns "" for nil.
+func Hash(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// SQLSink keeps entries in the server's database.
+type SQLSink struct {
+	Store *store.Store
+}
+
+func (s *SQLSink) Append(e Entry) (Entry, error) {
+	return s.Store.AppendAudit(e)
+}
+
+func (s *SQLSink) Query(q Query) ([]Entry, error) {
+	return s.Store.AuditEntries(q)
+}
+
+func (s *SQLSink) Prune(cutoff time.Time) (int64, error) {
+	return s.Store.PruneAudit(cutoff)
+}
@@ -0,0 +1,26 @@
+package audit
+
+import "github.com/NicholasRucinski/commentasaurus/internal/utils"
+
+// Change holds the hashes of a comment before and after an edit.
+type Change struct {
+	Before, After string
+}
+
+// Track wraps a utils.ModifyComment callback so c records the comment as it
+// was read and as it is written back.
+func (c *Change) Track(modify func(body *string, meta *utils.CommentMetadata)) func(body *string, meta *utils.CommentMetadata) {
+	return func(body *string, meta *utils.CommentMetadata) {
+		c.Before = CommentHash(*body, *meta)
+		modify(body, meta)
+		c.After = CommentHash(*body, *meta)
+	}
+}
+
+// CommentHash fingerprints a comment's text and metadata.
+func CommentHash(body string, meta utils.CommentMetadata) string {
+	return Hash(struct {
+		Body string                `json:"body"`
+		Meta utils.CommentMetadata `json:"meta"`
+	}{body, meta})
+}
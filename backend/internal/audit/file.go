@@ -0,0 +1,256 @@
+package audit
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSink appends entries to JSON Lines files, one per UTC day, for
+// shipping to a log pipeline or keeping on write-once storage. A path of
+// audit.jsonl writes audit-2026-01-02.jsonl and so on next to it.
+type FileSink struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	day    string
+	nextID int64
+}
+
+const dayLayout = "2006-01-02"
+
+func OpenFile(path string) (*FileSink, error) {
+	s := &FileSink{path: path, nextID: 1}
+
+	// IDs carry on from the last entry already written.
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range slices.Backward(files) {
+		entries, err := read(f.path)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(entries); n > 0 {
+			s.nextID = entries[n-1].ID + 1
+			break
+		}
+	}
+
+	if err := s.rotate(time.Now().UTC().Format(dayLayout)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Append(e Entry) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if day := e.Time.UTC().Format(dayLayout); day != s.day && !e.Time.IsZero() {
+		if err := s.rotate(day); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	e.ID = s.nextID
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return Entry{}, err
+	}
+	s.nextID++
+	return e, nil
+}
+
+// Query reads every day's file, which is fine at the sizes a retention
+// policy keeps them to. Days before q.Since are skipped.
+func (s *FileSink) Query(q Query) ([]Entry, error) {
+	s.mu.Lock()
+	entries, err := s.readSince(q.Since)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []Entry{}
+	for _, e := range slices.Backward(entries) {
+		if len(matched) == q.Limit {
+			break
+		}
+		if matches(e, q) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, nil
+}
+
+// Prune deletes the files of days that ended before cutoff. Files are only
+// ever deleted whole, so entries from the day cutoff falls on are kept until
+// the next run after midnight.
+func (s *FileSink) Prune(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned int64
+	for _, f := range files {
+		if f.path == s.file.Name() || (f.day != "" && f.end().After(cutoff)) {
+			continue
+		}
+		entries, err := read(f.path)
+		if err != nil {
+			return pruned, err
+		}
+		// The file from before daily files has no date to go by.
+		if n := len(entries); f.day == "" && n > 0 && !entries[n-1].Time.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return pruned, err
+		}
+		pruned += int64(len(entries))
+	}
+	return pruned, nil
+}
+
+// readSince reads the entries of every day not over before since, oldest
+// first.
+func (s *FileSink) readSince(since time.Time) ([]Entry, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range files {
+		if !since.IsZero() && f.day != "" && !f.end().After(since) {
+			continue
+		}
+		day, err := read(f.path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, day...)
+	}
+	return entries, nil
+}
+
+// rotate switches appends to day's file. It must be called with s.mu held,
+// or before s is shared.
+func (s *FileSink) rotate(day string) error {
+	ext := filepath.Ext(s.path)
+	path := strings.TrimSuffix(s.path, ext) + "-" + day + ext
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit: opening %s: %w", path, err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.day = f, day
+	return nil
+}
+
+type logFile struct {
+	path string
+	// day is empty for the single file written before daily files.
+	day string
+}
+
+// end is when the file's day is over.
+func (f logFile) end() time.Time {
+	t, _ := time.Parse(dayLayout, f.day)
+	return t.AddDate(0, 0, 1)
+}
+
+// files lists the log's files, oldest first.
+func (s *FileSink) files() ([]logFile, error) {
+	dir, base := filepath.Split(s.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	dirEntries, err := os.ReadDir(cmp.Or(dir, "."))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: listing %s: %w", dir, err)
+	}
+
+	var files []logFile
+	for _, de := range dirEntries {
+		name := de.Name()
+		if name == base {
+			files = append(files, logFile{path: s.path})
+			continue
+		}
+		day, ok := strings.CutPrefix(strings.TrimSuffix(name, ext), prefix)
+		if !ok || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := time.Parse(dayLayout, day); err != nil {
+			continue
+		}
+		files = append(files, logFile{path: filepath.Join(dir, name), day: day})
+	}
+	// The undated file comes first; dates sort as strings.
+	slices.SortFunc(files, func(a, b logFile) int { return strings.Compare(a.day, b.day) })
+	return files, nil
+}
+
+func read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: reading %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit: %s line %d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// matches applies q the way the SQL sink does.
+func matches(e Entry, q Query) bool {
+	switch {
+	case q.Actor != "" && !strings.EqualFold(e.Actor, q.Actor),
+		q.Action != "" && e.Action != q.Action,
+		q.Target != "" && e.Target != q.Target,
+		q.Org != "" && !strings.EqualFold(e.Org, q.Org),
+		q.Repo != "" && !strings.EqualFold(e.Repo, q.Repo),
+		!q.Since.IsZero() && e.Time.Before(q.Since),
+		!q.Until.IsZero() && e.Time.After(q.Until),
+		q.BeforeID > 0 && e.ID >= q.BeforeID:
+		return false
+	}
+	return true
+}
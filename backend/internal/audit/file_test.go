@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileSinkRotatesDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+
+	// A log from before daily files, ending on March 1st.
+	legacy := `{"id":1,"time":"2026-02-27T09:00:00Z","action":"comment.create"}` + "\n" +
+		`{"id":2,"time":"2026-03-01T09:00:00Z","action":"comment.edit"}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []int{2, 2, 5, 9} {
+		if _, err := sink.Append(Entry{Time: day(d), Action: "comment.resolve"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"audit-2026-03-02.jsonl", "audit-2026-03-05.jsonl", "audit-2026-03-09.jsonl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+
+	// IDs carry on across files and restarts.
+	sink, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := sink.Append(Entry{Time: day(9), Action: "user.ban"}); err != nil || e.ID != 7 {
+		t.Fatalf("Append after reopening = %d, %v, want ID 7", e.ID, err)
+	}
+
+	entries, err := sink.Query(Query{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if want := []int64{7, 6, 5, 4, 3, 2, 1}; !slices.Equal(ids, want) {
+		t.Errorf("Query IDs = %v, want %v", ids, want)
+	}
+
+	kept, err := os.ReadFile(filepath.Join(dir, "audit-2026-03-05.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// March 2nd is over by the cutoff, March 5th isn't.
+	pruned, err := sink.Prune(time.Date(2026, 3, 5, 8, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 4 {
+		t.Errorf("Prune = %d, want the legacy file's 2 and March 2nd's 2", pruned)
+	}
+	for name, want := range map[string]bool{"audit.jsonl": false, "audit-2026-03-02.jsonl": false, "audit-2026-03-05.jsonl": true, "audit-2026-03-09.jsonl": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s exists = %v after pruning, want %v", name, err == nil, want)
+		}
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "audit-2026-03-05.jsonl")); string(after) != string(kept) {
+		t.Errorf("pruning rewrote a file it kept")
+	}
+
+	if entries, _ := sink.Query(Query{Limit: 10, Since: day(6)}); len(entries) != 2 {
+		t.Errorf("Query since March 6th = %d entries, want 2", len(entries))
+	}
+}
@@ -6,23 +6,40 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/NicholasRucinski/commentasaurus/internal/crypto"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
 	"github.com/NicholasRucinski/commentasaurus/internal/user"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type Handler struct{}
+type Handler struct {
+	Store    *store.Store
+	Sessions *Sessions
+	// OAuthClientID and OAuthSecret identify the GitHub OAuth app users
+	// sign in through.
+	OAuthClientID string
+	OAuthSecret   string
+	// CookieDomain is set on the session cookies when not on localhost,
+	// unless the site the login started from has its own.
+	CookieDomain string
+	Sites        CookieDomains
+}
 
-func (h *Handler) StartAuth(w http.ResponseWriter, r *http.Request) {
+// CookieDomains finds the cookie domain of the site served from origin.
+type CookieDomains interface {
+	CookieDomainFor(origin string) (string, bool)
+}
 
-	clientID := os.Getenv("OAUTH_ClIENT_ID")
+func (h *Handler) StartAuth(w http.ResponseWriter, r *http.Request) {
 
 	redirectBack := r.URL.Query().Get("redirect_uri")
 	if redirectBack == "" {
@@ -38,7 +55,7 @@ func (h *Handler) StartAuth(w http.ResponseWriter, r *http.Request) {
 
 	scopes := "read:user user:email public_repo"
 
-	redirectUrl := fmt.Sprintf("https://github.com/login/oauth/authorize?client_id=%s&scope=%s", clientID, scopes)
+	redirectUrl := fmt.Sprintf("https://github.com/login/oauth/authorize?client_id=%s&scope=%s", h.OAuthClientID, scopes)
 
 	http.Redirect(w, r, redirectUrl, http.StatusTemporaryRedirect)
 
@@ -46,10 +63,9 @@ func (h *Handler) StartAuth(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) AuthCallback(w http.ResponseWriter, r *http.Request) {
 
-	encryptionKey := []byte(os.Getenv("COOKIE_KEY"))
+	encryptionKey := []byte(h.Sessions.CookieKey)
 	if len(encryptionKey) != 32 {
-		log.Println("FATAL: COOKIE_ENCRYPTION_KEY is not 32 bytes")
-		log.Println(len(encryptionKey))
+		slog.ErrorContext(r.Context(), "COOKIE_KEY must be 32 bytes")
 		http.Error(w, "server configuration error", 500)
 		return
 	}
@@ -60,26 +76,36 @@ func (h *Handler) AuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := getAccessToken(code)
+	client := logging.Client(r.Context())
+
+	accessToken, err := getAccessToken(client, h.OAuthClientID, h.OAuthSecret, code)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
+		return
 	}
 
-	userData, err := getUserData(accessToken)
+	userData, err := getUserData(client, accessToken)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if h.Store != nil {
+		if err := h.Store.RecordUser(userData.Login, userData.Email); err != nil {
+			slog.ErrorContext(r.Context(), "failed to record user", "login", userData.Login, "err", err)
+		}
 	}
 
 	claims := jwt.MapClaims{
 		"user_id":    userData.ID,
-		"name":       userData.Login,
+		"login":      userData.Login,
 		"email":      userData.Email,
 		"avatar_url": userData.AvatarUrl,
 		"orgs":       userData.OrgLogins,
 		"exp":        time.Now().Add(24 * time.Hour).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	signed, _ := token.SignedString([]byte(h.Sessions.JWTSecret))
 
 	encryptedToken, err := crypto.Encrypt(encryptionKey, accessToken)
 	if err != nil {
@@ -87,8 +113,21 @@ func (h *Handler) AuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	redirectAfter, err := r.Cookie("redirect_after_login")
+	redirectURL := "http://localhost:3000"
+	if err == nil {
+		redirectURL, _ = url.QueryUnescape(redirectAfter.Value)
+	}
+
 	isLocalHost := strings.Contains(r.Host, "localhost")
 
+	cookieDomain := h.CookieDomain
+	if u, err := url.Parse(redirectURL); err == nil && h.Sites != nil {
+		if domain, ok := h.Sites.CookieDomainFor(u.Scheme + "://" + u.Host); ok {
+			cookieDomain = domain
+		}
+	}
+
 	sessionCookie := &http.Cookie{
 		Name:     "session",
 		Value:    signed,
@@ -106,11 +145,11 @@ func (h *Handler) AuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !isLocalHost {
-		sessionCookie.Domain = ".nickrucinski.com"
+		sessionCookie.Domain = cookieDomain
 		sessionCookie.Secure = true
 		sessionCookie.SameSite = http.SameSiteNoneMode
 
-		githubCookie.Domain = ".nickrucinski.com"
+		githubCookie.Domain = cookieDomain
 		githubCookie.Secure = true
 		githubCookie.SameSite = http.SameSiteNoneMode
 	}
@@ -118,54 +157,83 @@ func (h *Handler) AuthCallback(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, sessionCookie)
 	http.SetCookie(w, githubCookie)
 
-	redirectAfter, err := r.Cookie("redirect_after_login")
-	redirectURL := "http://localhost:3000"
-	if err == nil {
-		redirectURL, _ = url.QueryUnescape(redirectAfter.Value)
-	}
-
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
 func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
-	if err != nil {
-		log.Println(err)
+	user, err := h.Sessions.User(r)
+	if errors.Is(err, http.ErrNoCookie) {
+		slog.DebugContext(r.Context(), "no session", "err", err)
 		json.NewEncoder(w).Encode(map[string]any{
 			"user": nil,
 		})
 		return
 	}
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
 
-	tokenStr := cookie.Value
-	claims := jwt.MapClaims{}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"user": user,
+	})
+}
+
+// Sessions holds the secrets behind the cookies AuthCallback sets and the
+// logins of global admins.
+type Sessions struct {
+	JWTSecret  string
+	CookieKey  string
+	AdminUsers []string
+}
 
-	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+// User returns the user stored in the signed session cookie.
+// It returns http.ErrNoCookie when the request has no session at all.
+func (s *Sessions) User(r *http.Request) (*user.User, error) {
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(cookie.Value, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.JWTSecret), nil
 	})
 	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
 
-		http.Error(w, "invalid token", http.StatusUnauthorized)
-		return
+	// Sessions from before the login claim hold a display name instead and
+	// have to sign in again.
+	login, _ := claims["login"].(string)
+	if login == "" {
+		return nil, errors.New("invalid token")
 	}
 
-	user := user.User{
+	u := &user.User{
 		ID:        int64(claims["user_id"].(float64)),
-		Login:     claims["name"].(string),
+		Login:     login,
 		Email:     claims["email"].(string),
 		AvatarUrl: claims["avatar_url"].(string),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"user": user,
-	})
-}
+	if orgs, ok := claims["orgs"].([]interface{}); ok {
+		for _, org := range orgs {
+			if login, ok := org.(string); ok {
+				u.OrgLogins = append(u.OrgLogins, login)
+			}
+		}
+	}
 
-func getAccessToken(code string) (string, error) {
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		u.ExpiresAt = exp.Time
+	}
 
-	clientID := os.Getenv("OAUTH_ClIENT_ID")
-	secret := os.Getenv("OAUTH_SECRET")
+	return u, nil
+}
+
+func getAccessToken(client *http.Client, clientID, secret, code string) (string, error) {
 
 	data := map[string]string{
 		"client_id":     clientID,
@@ -173,8 +241,6 @@ func getAccessToken(code string) (string, error) {
 		"code":          code,
 	}
 
-	client := &http.Client{}
-
 	b, _ := json.Marshal(data)
 	req, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", bytes.NewBuffer(b))
 	if err != nil {
@@ -184,7 +250,7 @@ func getAccessToken(code string) (string, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := metrics.Do(client, "oauthAccessToken", req)
 	if err != nil {
 		return "", err
 	}
@@ -204,25 +270,32 @@ func getAccessToken(code string) (string, error) {
 	return tokenResp.AccessToken, nil
 }
 
-func getUserData(accessToken string) (*user.User, error) {
-	client := &http.Client{}
-
+func getUserData(client *http.Client, accessToken string) (*user.User, error) {
 	userReq, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
 	userReq.Header.Set("Authorization", "Bearer "+accessToken)
 
-	userResp, err := client.Do(userReq)
+	userResp, err := metrics.Do(client, "viewer", userReq)
 	if err != nil {
 		return nil, err
 	}
 	defer userResp.Body.Close()
 
+	// user.User's JSON names are the plugin's, where "name" is the login.
+	var viewer struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Email     string `json:"email"`
+		AvatarUrl string `json:"avatar_url"`
+	}
 	body, _ := io.ReadAll(userResp.Body)
-	var userData user.User
-	json.Unmarshal(body, &userData)
+	if err := json.Unmarshal(body, &viewer); err != nil || viewer.Login == "" {
+		return nil, fmt.Errorf("unexpected GitHub user response (%d)", userResp.StatusCode)
+	}
+	userData := user.User{ID: viewer.ID, Login: viewer.Login, Email: viewer.Email, AvatarUrl: viewer.AvatarUrl}
 
 	userReq, _ = http.NewRequest("GET", "https://api.github.com/user/orgs", nil)
 	userReq.Header.Set("Authorization", "Bearer "+accessToken)
-	orgsResp, err := client.Do(userReq)
+	orgsResp, err := metrics.Do(client, "viewerOrgs", userReq)
 	if err != nil {
 		return nil, err
 	}
@@ -241,5 +314,47 @@ func getUserData(accessToken string) (*user.User, error) {
 
 	userData.OrgLogins = orgLogins
 
+	if userData.Email == "" {
+		userData.Email = getPrimaryEmail(client, accessToken)
+	}
+
 	return &userData, nil
 }
+
+// getPrimaryEmail reads the user's primary verified address, which GitHub
+// leaves out of /user when the user keeps their email private.
+func getPrimaryEmail(client *http.Client, accessToken string) string {
+	req, _ := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := metrics.Do(client, "viewerEmails", req)
+	if err != nil {
+		slog.Warn("auth: fetching user emails failed", "err", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return ""
+	}
+
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email
+		}
+	}
+	return ""
+}
+
+// IsAdmin reports whether u is one of AdminUsers.
+func (s *Sessions) IsAdmin(u *user.User) bool {
+	if u == nil {
+		return false
+	}
+	return slices.ContainsFunc(s.AdminUsers, func(login string) bool { return strings.EqualFold(login, u.Login) })
+}
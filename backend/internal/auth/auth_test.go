@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+// fakeGitHub answers GitHub API calls by path. It replaces
+// http.DefaultTransport, which logging.Client sends requests through.
+type fakeGitHub map[string]string
+
+func (f fakeGitHub) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := f[req.URL.Path]
+	status := http.StatusOK
+	if !ok {
+		status, body = http.StatusNotFound, `{"message":"Not Found"}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func useFakeGitHub(t *testing.T, f fakeGitHub) {
+	t.Helper()
+	saved := http.DefaultTransport
+	http.DefaultTransport = f
+	t.Cleanup(func() { http.DefaultTransport = saved })
+}
+
+func TestAuthCallbackUsesLogin(t *testing.T) {
+	useFakeGitHub(t, fakeGitHub{
+		"/login/oauth/access_token": `{"access_token":"gho_test"}`,
+		"/user":                     `{"id":583231,"login":"octocat","name":"The Octocat","email":null,"avatar_url":"https://example.com/a.png"}`,
+		"/user/orgs":                `[{"login":"github"}]`,
+		"/user/emails":              `[{"email":"octocat@example.com","primary":true,"verified":true}]`,
+	})
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	sessions := &Sessions{JWTSecret: "secret", CookieKey: strings.Repeat("k", 32), AdminUsers: []string{"OctoCat"}}
+	h := &Handler{Store: st, Sessions: sessions}
+
+	rec := httptest.NewRecorder()
+	h.AuthCallback(rec, httptest.NewRequest("GET", "http://localhost/auth/callback?code=abc", nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("AuthCallback status = %d: %s", rec.Code, rec.Body)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/me", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	viewer, err := sessions.User(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if viewer.Login != "octocat" {
+		t.Errorf("session login = %q, want octocat", viewer.Login)
+	}
+	if !viewer.IsInOrg([]string{"github"}) {
+		t.Errorf("session orgs = %v, want github", viewer.OrgLogins)
+	}
+	if !sessions.IsAdmin(viewer) {
+		t.Errorf("IsAdmin(%q) = false with admin_users [OctoCat]", viewer.Login)
+	}
+
+	prefs, err := st.GetUser("octocat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Email != "octocat@example.com" {
+		t.Errorf("recorded email for octocat = %q, want octocat@example.com", prefs.Email)
+	}
+	if prefs, _ := st.GetUser("The Octocat"); prefs.Email != "" {
+		t.Errorf("user recorded under display name with email %q", prefs.Email)
+	}
+}
+
+func TestAuthCallbackRejectsUserWithoutLogin(t *testing.T) {
+	useFakeGitHub(t, fakeGitHub{
+		"/login/oauth/access_token": `{"access_token":"gho_test"}`,
+		"/user":                     `{"message":"Bad credentials"}`,
+	})
+
+	h := &Handler{Sessions: &Sessions{JWTSecret: "secret", CookieKey: strings.Repeat("k", 32)}}
+	rec := httptest.NewRecorder()
+	h.AuthCallback(rec, httptest.NewRequest("GET", "http://localhost/auth/callback?code=abc", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("AuthCallback status = %d, want 500", rec.Code)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session" {
+			t.Errorf("session cookie set after a failed lookup")
+		}
+	}
+}
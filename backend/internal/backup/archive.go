@@ -0,0 +1,179 @@
+// Package backup snapshots a repo's comments into a tar archive of JSON
+// documents and restores them.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// FormatVersion is written to every manifest. Bump it when the archive
+// layout changes; Read refuses archives newer than it understands.
+const FormatVersion = 1
+
+const (
+	formatName   = "commentasaurus-backup"
+	manifestName = "manifest.json"
+	pagesDir     = "pages/"
+)
+
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	Category  string    `json:"category"`
+	Pages     int       `json:"pages"`
+	Comments  int       `json:"comments"`
+	Authors   []string  `json:"authors"`
+}
+
+// Page is one discussion. Comments are in thread order with their metadata
+// already split out of the body.
+type Page struct {
+	Page         string          `json:"page"`
+	DiscussionID string          `json:"discussionId"`
+	Labels       []string        `json:"labels"`
+	Comments     []utils.Comment `json:"comments"`
+}
+
+type Archive struct {
+	Manifest Manifest
+	Pages    []Page
+}
+
+// New builds an archive from the discussions in a repo's comment category.
+func New(org, repo, category string, discussions []utils.PageDiscussion) Archive {
+	a := Archive{Manifest: Manifest{
+		Format:    formatName,
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Org:       org,
+		Repo:      repo,
+		Category:  category,
+		Authors:   []string{},
+	}}
+
+	seen := map[string]bool{}
+	for _, d := range discussions {
+		a.Pages = append(a.Pages, Page{Page: d.Page, DiscussionID: d.ID, Labels: d.Labels, Comments: d.Comments})
+		a.Manifest.Comments += len(d.Comments)
+		for _, c := range d.Comments {
+			if c.User != "" && !seen[c.User] {
+				seen[c.User] = true
+				a.Manifest.Authors = append(a.Manifest.Authors, c.User)
+			}
+		}
+	}
+	a.Manifest.Pages = len(a.Pages)
+	return a
+}
+
+// Write stores the manifest first so Read can check the version before
+// decoding anything else. Output is gzipped when compress is set.
+func (a Archive) Write(w io.Writer, compress bool) error {
+	if compress {
+		gz := gzip.NewWriter(w)
+		if err := a.Write(gz, false); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeJSON(tw, manifestName, a.Manifest, a.Manifest.CreatedAt); err != nil {
+		return err
+	}
+	for i, p := range a.Pages {
+		if err := writeJSON(tw, fmt.Sprintf("%s%05d.json", pagesDir, i), p, a.Manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeJSON(tw *tar.Writer, name string, v any, modTime time.Time) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// Read loads an archive written by Write, gzipped or not.
+func Read(r io.Reader) (Archive, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return Archive{}, fmt.Errorf("reading archive: %w", err)
+	}
+	var src io.Reader = br
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return Archive{}, fmt.Errorf("reading archive: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	var a Archive
+	haveManifest := false
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Archive{}, fmt.Errorf("reading archive: %w", err)
+		}
+
+		switch {
+		case hdr.Name == manifestName:
+			if err := json.NewDecoder(tr).Decode(&a.Manifest); err != nil {
+				return Archive{}, fmt.Errorf("reading manifest: %w", err)
+			}
+			if a.Manifest.Format != formatName {
+				return Archive{}, errors.New("not a commentasaurus backup")
+			}
+			if a.Manifest.Version > FormatVersion {
+				return Archive{}, fmt.Errorf("backup version %d is newer than supported version %d", a.Manifest.Version, FormatVersion)
+			}
+			haveManifest = true
+		case strings.HasPrefix(hdr.Name, pagesDir) && path.Ext(hdr.Name) == ".json":
+			if !haveManifest {
+				return Archive{}, errors.New("backup is missing its manifest")
+			}
+			var p Page
+			if err := json.NewDecoder(tr).Decode(&p); err != nil {
+				return Archive{}, fmt.Errorf("reading %s: %w", hdr.Name, err)
+			}
+			a.Pages = append(a.Pages, p)
+		}
+	}
+
+	if !haveManifest {
+		return Archive{}, errors.New("backup is missing its manifest")
+	}
+	if len(a.Pages) != a.Manifest.Pages {
+		return Archive{}, fmt.Errorf("backup is incomplete: manifest lists %d pages, found %d", a.Manifest.Pages, len(a.Pages))
+	}
+	return a, nil
+}
@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+type node struct {
+	ID     string `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+	ReplyTo   *struct {
+		ID string `json:"id"`
+	} `json:"replyTo"`
+	Replies struct {
+		Nodes []*node `json:"nodes"`
+	} `json:"replies"`
+}
+
+type discussion struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Comments struct {
+		Nodes []*node `json:"nodes"`
+	} `json:"comments"`
+}
+
+// repo is a comment category on GitHub, kept in memory. Comments posted to
+// it are authored by login.
+type repo struct {
+	login       string
+	discussions []*discussion
+	next        int
+}
+
+func (rp *repo) id(prefix string) string {
+	rp.next++
+	return fmt.Sprintf("%s%d", prefix, rp.next)
+}
+
+func (rp *repo) comment(d *discussion, author, body, replyTo string) *node {
+	n := &node{ID: rp.id("DC_"), Body: body, CreatedAt: "2026-02-03T04:05:06Z", UpdatedAt: "2026-02-03T04:05:06Z"}
+	n.Author.Login = author
+	if replyTo == "" {
+		d.Comments.Nodes = append(d.Comments.Nodes, n)
+		return n
+	}
+	for _, top := range d.Comments.Nodes {
+		if top.ID == replyTo {
+			n.ReplyTo = &struct {
+				ID string `json:"id"`
+			}{replyTo}
+			top.Replies.Nodes = append(top.Replies.Nodes, n)
+			return n
+		}
+	}
+	panic("no comment " + replyTo)
+}
+
+func (rp *repo) page(title string) *discussion {
+	for _, d := range rp.discussions {
+		if d.Title == title {
+			return d
+		}
+	}
+	d := &discussion{ID: rp.id("D_"), Title: title}
+	rp.discussions = append(rp.discussions, d)
+	return d
+}
+
+func (rp *repo) client(t *testing.T) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+
+		var data any
+		switch op := metrics.GraphQLOperation(req.Query); op {
+		case "listPageDiscussions":
+			data = map[string]any{"repository": map[string]any{"discussions": map[string]any{"nodes": rp.discussions}}}
+		case "search":
+			var found []*discussion
+			for _, d := range rp.discussions {
+				if strings.Contains(req.Variables["query"].(string), `"`+d.Title+`"`) {
+					found = append(found, d)
+				}
+			}
+			data = map[string]any{"search": map[string]any{"nodes": found}}
+		case "createDiscussion":
+			data = map[string]any{"createDiscussion": map[string]any{"discussion": rp.page(req.Variables["title"].(string))}}
+		case "addDiscussionComment":
+			var d *discussion
+			for _, candidate := range rp.discussions {
+				if candidate.ID == req.Variables["discussionId"] {
+					d = candidate
+				}
+			}
+			replyTo, _ := req.Variables["replyToId"].(string)
+			data = map[string]any{"addDiscussionComment": map[string]any{"comment": rp.comment(d, rp.login, req.Variables["body"].(string), replyTo)}}
+		default:
+			t.Fatalf("unexpected %s", op)
+		}
+
+		body, err := json.Marshal(map[string]any{"data": data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})}
+}
+
+func withMetadata(comment string, meta utils.CommentMetadata) string {
+	meta.Version = utils.MetadataVersion
+	data, _ := json.Marshal(meta)
+	return comment + "\n\n<!-- commentasaurus:" + string(data) + "-->"
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	src := &repo{}
+	intro := src.page("Page: /intro")
+	first := src.comment(intro, "alice", withMetadata("Typo here", utils.CommentMetadata{
+		Page: "/intro", ContextBefore: "the ", Text: "quick", ContextAfter: " fox", Mentions: []string{"bob"},
+	}), "")
+	src.comment(intro, "bob", withMetadata("Fixed", utils.CommentMetadata{Page: "/intro"}), first.ID)
+	src.comment(intro, "", withMetadata("Also this", utils.CommentMetadata{
+		Page: "/intro", Text: "jumps", Resolved: true, ResolvedAt: "2026-02-04T00:00:00Z",
+	}), "")
+	src.comment(src.page("Page: /guide/setup"), "carol", withMetadata("Needs a screenshot", utils.CommentMetadata{Page: "/guide/setup", Text: "Install"}), "")
+	src.page("Page: /empty")
+
+	discussions, err := utils.ListPageDiscussions(src.client(t), "t", "acme", "docs", "CAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := New("acme", "docs", "Comments", discussions)
+
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := archive.Write(&buf, compress); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("Read(compress=%v): %v", compress, err)
+		}
+		if !got.Manifest.CreatedAt.Equal(archive.Manifest.CreatedAt) {
+			t.Errorf("compress=%v: created %v, want %v", compress, got.Manifest.CreatedAt, archive.Manifest.CreatedAt)
+		}
+		got.Manifest.CreatedAt = archive.Manifest.CreatedAt
+		if !reflect.DeepEqual(got, archive) {
+			t.Errorf("compress=%v: read back\n%+v\nwant\n%+v", compress, got, archive)
+		}
+	}
+	if m := archive.Manifest; m.Pages != 3 || m.Comments != 4 || !reflect.DeepEqual(m.Authors, []string{"alice", "bob", "carol"}) {
+		t.Errorf("manifest = %+v", m)
+	}
+
+	dst := &repo{login: "restorer"}
+	rs := &Restorer{Client: dst.client(t), Token: "t", Org: "acme", Repo: "docs-copy", CategoryID: "CAT", RepoID: "R"}
+	res, err := rs.Restore(archive, RestoreOptions{OnConflict: ConflictFail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (RestoreResult{Pages: 2, Restored: 4}) {
+		t.Errorf("Restore = %+v", res)
+	}
+
+	restored, err := utils.ListPageDiscussions(dst.client(t), "t", "acme", "docs-copy", "CAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("restored %d pages, want 2", len(restored))
+	}
+	// Everything but who posted it and when comes back as it was, with
+	// replies under the copy of their parent.
+	copies := map[string]string{}
+	for i, d := range restored {
+		want := archive.Pages[i]
+		if d.Page != want.Page || len(d.Comments) != len(want.Comments) {
+			t.Fatalf("page %d = %s with %d comments, want %s with %d", i, d.Page, len(d.Comments), want.Page, len(want.Comments))
+		}
+		for j, c := range d.Comments {
+			orig := want.Comments[j]
+			copies[orig.ID] = c.ID
+			if c.ImportedFrom != orig.ID || c.ReplyTo != copies[orig.ReplyTo] {
+				t.Errorf("%s: copy of %s is from %q replying to %q", d.Page, orig.ID, c.ImportedFrom, c.ReplyTo)
+			}
+			comment, credit, _ := strings.Cut(c.Comment, "\n\n")
+			if comment != orig.Comment || c.Text != orig.Text || c.BeforeContext != orig.BeforeContext || c.AfterContext != orig.AfterContext ||
+				c.Resolved != orig.Resolved || c.ResolvedAt != orig.ResolvedAt || !reflect.DeepEqual(c.Mentions, orig.Mentions) {
+				t.Errorf("%s: copy of %s = %+v, want %+v", d.Page, orig.ID, c, orig)
+			}
+			if author := cmp.Or(orig.User, "a deleted user"); !strings.Contains(credit, author+" on February 3, 2026") {
+				t.Errorf("%s: copy of %s credits %q, want %s", d.Page, orig.ID, credit, author)
+			}
+		}
+	}
+
+	// A second run finds everything already there.
+	res, err = rs.Restore(archive, RestoreOptions{OnConflict: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (RestoreResult{Pages: 2, Skipped: 4}) {
+		t.Errorf("Restore again = %+v", res)
+	}
+	if _, err := rs.Restore(archive, RestoreOptions{OnConflict: ConflictFail}); err == nil {
+		t.Error("Restore with -on-conflict fail succeeded over existing comments")
+	}
+}
@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// Conflict decides what happens to a backed up comment that already exists
+// in the target, either because it was never lost or because an earlier
+// restore recreated it.
+type Conflict string
+
+const (
+	ConflictSkip      Conflict = "skip"
+	ConflictFail      Conflict = "fail"
+	ConflictDuplicate Conflict = "duplicate"
+)
+
+type RestoreOptions struct {
+	OnConflict Conflict
+	DryRun     bool
+	Log        io.Writer
+}
+
+type RestoreResult struct {
+	Pages    int
+	Restored int
+	Skipped  int
+}
+
+// Restorer recreates archived threads in a repo's comment category.
+type Restorer struct {
+	Client     *http.Client
+	Token      string
+	Org        string
+	Repo       string
+	CategoryID string
+	RepoID     string
+}
+
+func (rs *Restorer) Restore(a Archive, opts RestoreOptions) (RestoreResult, error) {
+	logf := func(format string, args ...any) {
+		if opts.Log != nil {
+			fmt.Fprintf(opts.Log, format+"\n", args...)
+		}
+	}
+
+	existing, err := utils.ListPageDiscussions(rs.Client, rs.Token, rs.Org, rs.Repo, rs.CategoryID)
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("listing existing comments: %w", err)
+	}
+	// Keyed by the comment's own ID and by the ID it was restored from.
+	present := map[string]string{}
+	for _, d := range existing {
+		for _, c := range d.Comments {
+			present[c.ID] = c.ID
+			if c.ImportedFrom != "" {
+				present[c.ImportedFrom] = c.ID
+			}
+		}
+	}
+
+	var res RestoreResult
+	for _, p := range a.Pages {
+		if len(p.Comments) == 0 {
+			continue
+		}
+		res.Pages++
+
+		discussionID := ""
+		ids := map[string]string{}
+		for _, c := range p.Comments {
+			if id, ok := present[c.ID]; ok && opts.OnConflict != ConflictDuplicate {
+				if opts.OnConflict == ConflictFail {
+					return res, fmt.Errorf("comment %s on %s already exists as %s", c.ID, p.Page, id)
+				}
+				ids[c.ID] = id
+				res.Skipped++
+				continue
+			}
+
+			replyTo := ""
+			if c.ReplyTo != "" {
+				replyTo = ids[c.ReplyTo]
+				if replyTo == "" && !opts.DryRun {
+					logf("%s: parent %s of %s is missing, restoring it as a new thread", p.Page, c.ReplyTo, c.ID)
+				}
+			}
+
+			res.Restored++
+			if opts.DryRun {
+				ids[c.ID] = c.ID
+				continue
+			}
+
+			if discussionID == "" {
+				discussionID, err = utils.FindOrCreateDiscussion(rs.Client, rs.Token, rs.Org, rs.Repo, p.Page, rs.CategoryID, rs.RepoID)
+				if err != nil {
+					return res, fmt.Errorf("finding discussion for %s: %w", p.Page, err)
+				}
+			}
+
+			meta := utils.CommentMetadata{
+				Page:          p.Page,
+				ContextBefore: c.BeforeContext,
+				Text:          c.Text,
+				ContextAfter:  c.AfterContext,
+				Resolved:      c.Resolved,
+				ResolvedAt:    c.ResolvedAt,
+				Mentions:      c.Mentions,
+				ImportedFrom:  c.ID,
+			}
+			created, err := utils.CreateComment(rs.Client, discussionID, rs.Token, attributed(c), meta, replyTo)
+			if err != nil {
+				return res, fmt.Errorf("restoring %s on %s: %w", c.ID, p.Page, err)
+			}
+			ids[c.ID] = created.ID
+		}
+		logf("%s: %d comments", p.Page, len(p.Comments))
+	}
+
+	return res, nil
+}
+
+// attributed credits the original author, since restored comments are
+// posted by whoever runs the restore.
+func attributed(c utils.Comment) string {
+	author := "@" + c.User
+	if c.User == "" {
+		author = "a deleted user"
+	}
+	date := c.CreatedAt
+	if t, err := time.Parse(time.RFC3339, c.CreatedAt); err == nil {
+		date = t.Format("January 2, 2006")
+	}
+	return fmt.Sprintf("%s\n\n_Originally posted by %s on %s._", strings.TrimSpace(c.Comment), author, date)
+}
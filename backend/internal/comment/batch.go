@@ -0,0 +1,95 @@
+package comments
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const maxBatchPages = 50
+
+type BatchRequest struct {
+	Pages []string        `json:"pages"`
+	Mode  utils.BatchMode `json:"mode"`
+}
+
+// Batch summarises several pages of a repo in one GitHub round trip. Mode is
+// count (the default), open or full.
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	level := CommentPermission(target.Level)
+
+	var githubToken string
+	var viewer *user.User
+	if level == PermissionAnonymous {
+		githubToken = h.GitHubToken
+	} else {
+		var err error
+		githubToken, err = h.userToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		viewer, _ = h.Sessions.User(r)
+	}
+	if !canView(viewer, org, level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Mode = cmp.Or(req.Mode, utils.BatchCount)
+	if req.Mode != utils.BatchCount && req.Mode != utils.BatchOpen && req.Mode != utils.BatchFull {
+		http.Error(w, "mode must be count, open or full", http.StatusBadRequest)
+		return
+	}
+
+	slices.Sort(req.Pages)
+	pages := slices.Compact(req.Pages)
+	if len(pages) == 0 {
+		http.Error(w, "pages is required", http.StatusBadRequest)
+		return
+	}
+	if len(pages) > maxBatchPages {
+		http.Error(w, fmt.Sprintf("at most %d pages per request", maxBatchPages), http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := utils.GetPagesComments(logging.Client(r.Context()), githubToken, org, repo, pages, req.Mode)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load page comments", "org", org, "repo", repo, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if level == PermissionAnonymous {
+		// Reactions were read with the server's token, not the reader's.
+		for _, summary := range summaries {
+			for i := range summary.Comments {
+				for j := range summary.Comments[i].Reactions {
+					summary.Comments[i].Reactions[j].ViewerHasReacted = false
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"pages": summaries})
+}
@@ -1,17 +1,58 @@
 package comments
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
 	"github.com/NicholasRucinski/commentasaurus/internal/crypto"
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/markdown"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/notify"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
 	"github.com/NicholasRucinski/commentasaurus/internal/utils"
 )
 
-type Handler struct{}
+type Handler struct {
+	Audit    *audit.Log
+	Events   *events.Broker
+	Notifier notify.Notifier
+	Sessions *auth.Sessions
+	Sites    *sites.Registry
+	Store    *store.Store
+	// GitHubToken reads comments for anonymous readers and sets up repos.
+	GitHubToken string
+
+	mu      sync.Mutex
+	members map[memberKey]memberEntry
+}
+
+const memberTTL = 5 * time.Minute
+
+// memberKey includes the token the lookup was made with, since private
+// memberships are only visible to some tokens.
+type memberKey struct {
+	token, org, login string
+}
+
+type memberEntry struct {
+	member    bool
+	checkedAt time.Time
+}
 
 type AddCommentRequest struct {
 	ID            string `json:"id"`
@@ -19,12 +60,11 @@ type AddCommentRequest struct {
 	Text          string `json:"text"`
 	ContextAfter  string `json:"contextAfter"`
 	Comment       string `json:"comment"`
+	ReplyTo       string `json:"replyTo,omitempty"`
 }
 
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request to create a comment")
-
-	encryptionKey := []byte(os.Getenv("COOKIE_KEY"))
+	encryptionKey := []byte(h.Sessions.CookieKey)
 
 	tokenCookie, err := r.Cookie("github_token")
 	if err != nil {
@@ -34,18 +74,26 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 
 	githubToken, err := crypto.Decrypt(encryptionKey, tokenCookie.Value)
 	if err != nil {
-		log.Printf("Failed to decrypt token: %v", err)
+		slog.WarnContext(r.Context(), "failed to decrypt token", "err", err)
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	categoryId := r.URL.Query().Get("category_id")
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	if !h.siteAllows(w, r, target) {
+		return
+	}
+
+	categoryId := target.CategoryID
 	if categoryId == "" {
 		http.Error(w, "Missing ?category_id= query parameter", http.StatusBadRequest)
 		return
 	}
 
-	repoId := r.URL.Query().Get("repo_id")
+	repoId := target.RepoID
 	if repoId == "" {
 		http.Error(w, "Missing ?repo_id= query parameter", http.StatusBadRequest)
 		return
@@ -55,13 +103,17 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	repo := r.PathValue("repo")
 	page := r.PathValue("page")
 
+	if h.banned(w, r, org) {
+		return
+	}
+
 	var incoming AddCommentRequest
 	if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	client := &http.Client{}
+	client := logging.Client(r.Context())
 
 	discussionID, err := utils.FindOrCreateDiscussion(client, githubToken, org, repo, page, categoryId, repoId)
 	if err != nil {
@@ -69,31 +121,48 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commentId, err := utils.CreateComment(client, discussionID, githubToken, incoming.Comment, incoming.ContextBefore, incoming.Text, incoming.ContextAfter, page)
+	mentions := utils.ResolveMentions(org, markdown.Mentions(incoming.Comment), h.isMember(client, githubToken, org))
+
+	meta := utils.CommentMetadata{
+		Page:          page,
+		ContextBefore: incoming.ContextBefore,
+		Text:          incoming.Text,
+		ContextAfter:  incoming.ContextAfter,
+		Mentions:      mentions,
+	}
+	comment, err := utils.CreateComment(client, discussionID, githubToken, incoming.Comment, meta, incoming.ReplyTo)
 	if err != nil {
-		log.Println(err.Error())
+		slog.ErrorContext(r.Context(), "failed to create comment", "org", org, "repo", repo, "page", page, "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	h.record(r, "comment.create", comment.ID, org, repo, page, audit.Change{After: audit.CommentHash(incoming.Comment, meta)})
+
+	h.publish(events.Created, org, repo, page, comment.User, comment)
+	h.notifyMentions(org, repo, page, comment, mentions)
+
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(commentId)
+	json.NewEncoder(w).Encode(comment.ID)
 
 }
 
 func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
-	log.Println("Getting all comments")
+	encryptionKey := []byte(h.Sessions.CookieKey)
 
-	encryptionKey := []byte(os.Getenv("COOKIE_KEY"))
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
 
-	permissionLevel := r.URL.Query().Get("permission_level")
+	permissionLevel := target.Level
 	var githubToken string
 
 	if permissionLevel != "anon" {
 		tokenCookie, err := r.Cookie("github_token")
 		if err != nil {
-			log.Println(err)
+			slog.DebugContext(r.Context(), "no session, returning no comments", "err", err)
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]utils.Comment{})
 			return
@@ -101,22 +170,25 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 
 		githubToken, err = crypto.Decrypt(encryptionKey, tokenCookie.Value)
 		if err != nil {
-			log.Printf("Failed to decrypt token: %v", err)
+			slog.WarnContext(r.Context(), "failed to decrypt token", "err", err)
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
 
 	} else {
-		githubToken = os.Getenv("GITHUB_TOKEN")
+		githubToken = h.GitHubToken
+	}
+	if !h.siteAllows(w, r, target) {
+		return
 	}
 
-	categoryId := r.URL.Query().Get("category_id")
+	categoryId := target.CategoryID
 	if categoryId == "" {
 		http.Error(w, "Missing ?category_id= query parameter", http.StatusBadRequest)
 		return
 	}
 
-	repoId := r.URL.Query().Get("repo_id")
+	repoId := target.RepoID
 	if repoId == "" {
 		http.Error(w, "Missing ?repo_id= query parameter", http.StatusBadRequest)
 		return
@@ -126,7 +198,7 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 	repo := r.PathValue("repo")
 	page := r.PathValue("page")
 
-	client := &http.Client{}
+	client := logging.Client(r.Context())
 
 	discussionID, err := utils.FindOrCreateDiscussion(client, githubToken, org, repo, page, categoryId, repoId)
 	if err != nil {
@@ -140,6 +212,15 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if permissionLevel == "anon" {
+		// Reactions were read with the server's token, not the reader's.
+		for i := range comments {
+			for j := range comments[i].Reactions {
+				comments[i].Reactions[j].ViewerHasReacted = false
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
 }
@@ -149,9 +230,12 @@ type ResolveCommentRequest struct {
 }
 
 func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
-	log.Println("Resolving a comment")
+	target, ok := h.target(w, r)
+	if !ok || !h.siteAllows(w, r, target) {
+		return
+	}
 
-	encryptionKey := []byte(os.Getenv("COOKIE_KEY"))
+	encryptionKey := []byte(h.Sessions.CookieKey)
 
 	tokenCookie, err := r.Cookie("github_token")
 	if err != nil {
@@ -161,29 +245,265 @@ func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
 
 	githubToken, err := crypto.Decrypt(encryptionKey, tokenCookie.Value)
 	if err != nil {
-		log.Printf("Failed to decrypt token: %v", err)
+		slog.WarnContext(r.Context(), "failed to decrypt token", "err", err)
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
 	page := r.PathValue("page")
 
+	if h.banned(w, r, org) {
+		return
+	}
+
 	var req ResolveCommentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println("Invalid request body: ", err)
+		slog.InfoContext(r.Context(), "invalid request body", "err", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	client := &http.Client{}
+	client := logging.Client(r.Context())
+
+	if !locate(w, client, githubToken, org, repo, page, req.ID) {
+		return
+	}
 
-	err = utils.UpdateComment(client, githubToken, req.ID, page)
+	var change audit.Change
+	comment, err := utils.ModifyComment(client, githubToken, req.ID, page, change.Track(utils.MarkResolved))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	actor := h.record(r, "comment.resolve", req.ID, org, repo, page, change)
+	h.publish(events.Resolved, org, repo, page, actor, comment)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"resolved"}`))
 }
+
+type EditCommentRequest struct {
+	ID      string `json:"id"`
+	Comment string `json:"comment"`
+}
+
+func (h *Handler) Edit(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.target(w, r)
+	if !ok || !h.siteAllows(w, r, target) {
+		return
+	}
+
+	githubToken, err := h.userToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+	page := r.PathValue("page")
+
+	if h.banned(w, r, org) {
+		return
+	}
+
+	var req EditCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client := logging.Client(r.Context())
+
+	if !locate(w, client, githubToken, org, repo, page, req.ID) {
+		return
+	}
+
+	mentions := utils.ResolveMentions(org, markdown.Mentions(req.Comment), h.isMember(client, githubToken, org))
+
+	var previous []string
+	var change audit.Change
+	comment, err := utils.ModifyComment(client, githubToken, req.ID, page, change.Track(func(body *string, meta *utils.CommentMetadata) {
+		previous = meta.Mentions
+		*body = req.Comment
+		meta.Mentions = mentions
+	}))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, "comment.edit", req.ID, org, repo, page, change)
+
+	h.publish(events.Edited, org, repo, page, comment.User, comment)
+
+	// Only people added by this edit hear about it.
+	var added []string
+	for _, login := range mentions {
+		if !slices.Contains(previous, login) {
+			added = append(added, login)
+		}
+	}
+	h.notifyMentions(org, repo, page, comment, added)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// locate checks the comment is on the page in the path. The site and its
+// permission level come from the path, so they only vouch for comments there.
+func locate(w http.ResponseWriter, client *http.Client, githubToken, org, repo, page, id string) bool {
+	loc, err := utils.LocateComment(client, githubToken, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	if !strings.EqualFold(loc.Owner, org) || !strings.EqualFold(loc.Repo, repo) || loc.Page != page {
+		http.Error(w, "comment not found on "+org+"/"+repo+"/"+page, http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// target looks up the site the request names, see sites.Registry.Resolve.
+func (h *Handler) target(w http.ResponseWriter, r *http.Request) (sites.Target, bool) {
+	target, err := h.Sites.Resolve(r)
+	if err != nil {
+		sites.Error(w, err)
+		return sites.Target{}, false
+	}
+	return target, true
+}
+
+// banned rejects users an admin has banned from commenting in org.
+func (h *Handler) banned(w http.ResponseWriter, r *http.Request, org string) bool {
+	if h.Store == nil {
+		return false
+	}
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		return false
+	}
+	banned, err := h.Store.IsBanned(viewer.Login, org)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check ban", "login", viewer.Login, "err", err)
+		return false
+	}
+	if banned {
+		http.Error(w, "you have been banned from commenting", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// isMember checks org membership with the commenter's token, remembering
+// the answers for memberTTL so mentioning the same people again is free.
+func (h *Handler) isMember(client *http.Client, githubToken, org string) func(login string) (bool, error) {
+	tokenHash := sha256.Sum256([]byte(githubToken))
+	return func(login string) (bool, error) {
+		key := memberKey{hex.EncodeToString(tokenHash[:]), strings.ToLower(org), strings.ToLower(login)}
+
+		h.mu.Lock()
+		entry, ok := h.members[key]
+		h.mu.Unlock()
+		fresh := ok && time.Since(entry.checkedAt) < memberTTL
+		metrics.CacheLookup("org_member", fresh)
+		if fresh {
+			return entry.member, nil
+		}
+
+		member, err := utils.IsOrgMember(client, githubToken, org, login)
+		if err != nil {
+			return false, err
+		}
+
+		h.mu.Lock()
+		if h.members == nil {
+			h.members = map[memberKey]memberEntry{}
+		}
+		if len(h.members) >= 1024 {
+			for k, e := range h.members {
+				if time.Since(e.checkedAt) >= memberTTL {
+					delete(h.members, k)
+				}
+			}
+		}
+		h.members[key] = memberEntry{member: member, checkedAt: time.Now()}
+		h.mu.Unlock()
+		return member, nil
+	}
+}
+
+// userToken returns the signed-in user's GitHub token from their cookie.
+func (h *Handler) userToken(r *http.Request) (string, error) {
+	tokenCookie, err := r.Cookie("github_token")
+	if err != nil {
+		return "", errors.New("unauthorized: missing token")
+	}
+
+	githubToken, err := crypto.Decrypt([]byte(h.Sessions.CookieKey), tokenCookie.Value)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to decrypt token", "err", err)
+		return "", errors.New("invalid token")
+	}
+
+	return githubToken, nil
+}
+
+// record adds a change made by the signed-in user to the audit log and
+// returns their login.
+func (h *Handler) record(r *http.Request, action, id, org, repo, page string, change audit.Change) string {
+	var actor string
+	if viewer, err := h.Sessions.User(r); err == nil {
+		actor = viewer.Login
+	}
+	h.Audit.Record(r, audit.Entry{
+		Actor:      actor,
+		Action:     action,
+		Target:     id,
+		Org:        org,
+		Repo:       repo,
+		Page:       page,
+		BeforeHash: change.Before,
+		AfterHash:  change.After,
+	})
+	return actor
+}
+
+func (h *Handler) publish(eventType events.Type, org, repo, page, actor string, comment utils.Comment) {
+	if h.Events == nil {
+		return
+	}
+	h.Events.Publish(events.Event{
+		Type:    eventType,
+		Org:     org,
+		Repo:    repo,
+		Page:    page,
+		Actor:   actor,
+		Comment: comment,
+	})
+}
+
+func (h *Handler) notifyMentions(org, repo, page string, comment utils.Comment, mentions []string) {
+	if h.Notifier == nil || len(mentions) == 0 {
+		return
+	}
+	n := notify.Notification{
+		Kind:       notify.KindMention,
+		Recipients: mentions,
+		Actor:      comment.User,
+		Org:        org,
+		Repo:       repo,
+		Page:       page,
+		Comment:    comment,
+	}
+	go func() {
+		if err := h.Notifier.Notify(context.Background(), n); err != nil {
+			slog.Error("failed to notify mentions", "comment", comment.ID, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,200 @@
+package comments
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/crypto"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+// offline fails any request that reaches GitHub.
+type offline struct{}
+
+func (offline) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+// graphQL answers GitHub GraphQL requests.
+type graphQL func(query string, variables map[string]any) string
+
+func (f graphQL) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(f(body.Query, body.Variables))),
+		Request:    req,
+	}, nil
+}
+
+// newTestHandler builds a Handler whose calls to GitHub go to github.
+func newTestHandler(t *testing.T, github http.RoundTripper) *Handler {
+	t.Helper()
+	saved := http.DefaultTransport
+	http.DefaultTransport = github
+	t.Cleanup(func() { http.DefaultTransport = saved })
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	registry, err := sites.NewRegistry(st, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Handler{
+		Sessions: &auth.Sessions{JWTSecret: "secret", CookieKey: strings.Repeat("k", 32)},
+		Sites:    registry,
+		Store:    st,
+	}
+}
+
+// signedIn builds a request to {org}/{repo}/{page} from login, whose
+// display name is something else entirely.
+func signedIn(t *testing.T, h *Handler, method, org, login, body string) *http.Request {
+	t.Helper()
+	session, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":    1,
+		"login":      login,
+		"name":       "Display Name",
+		"email":      "",
+		"avatar_url": "",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(h.Sessions.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := crypto.Encrypt([]byte(h.Sessions.CookieKey), "gho_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(method, "/comments/"+org+"/docs/intro?category_id=c&repo_id=r", strings.NewReader(body))
+	r.SetPathValue("org", org)
+	r.SetPathValue("repo", "docs")
+	r.SetPathValue("page", "intro")
+	r.AddCookie(&http.Cookie{Name: "session", Value: session})
+	r.AddCookie(&http.Cookie{Name: "github_token", Value: token})
+	return r
+}
+
+func TestBannedLoginCannotWrite(t *testing.T) {
+	h := newTestHandler(t, offline{})
+	// Bans are entered by hand, so the case needn't match.
+	if _, err := h.Store.Ban(store.Ban{Login: "OctoCat", Org: "acme", BannedBy: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := map[string]http.HandlerFunc{"Create": h.Create, "Edit": h.Edit, "Resolve": h.Resolve}
+	for name, write := range writes {
+		rec := httptest.NewRecorder()
+		write(rec, signedIn(t, h, "POST", "acme", "octocat", `{"id":"DC_1","comment":"hi"}`))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s by banned login = %d %q, want 403", name, rec.Code, rec.Body)
+		}
+
+		// The ban is per org: elsewhere the request gets as far as GitHub.
+		rec = httptest.NewRecorder()
+		write(rec, signedIn(t, h, "POST", "other", "octocat", `{"id":"DC_1","comment":"hi"}`))
+		if rec.Code == http.StatusForbidden {
+			t.Errorf("%s in another org = 403, want the ban ignored", name)
+		}
+	}
+}
+
+func TestWritesStayOnTheirPage(t *testing.T) {
+	discussions := map[string]string{
+		"DC_here":      `{"title":"Page: intro","repository":{"name":"Docs","owner":{"login":"ACME"}}}`,
+		"DC_otherpage": `{"title":"Page: setup","repository":{"name":"docs","owner":{"login":"acme"}}}`,
+		"DC_otherrepo": `{"title":"Page: intro","repository":{"name":"private","owner":{"login":"acme"}}}`,
+	}
+	var changed []any
+	h := newTestHandler(t, graphQL(func(query string, variables map[string]any) string {
+		if !strings.Contains(query, "LocateComment") {
+			changed = append(changed, variables["id"])
+			return `{"errors":[{"message":"not faked"}]}`
+		}
+		if d, ok := discussions[variables["id"].(string)]; ok {
+			return `{"data":{"node":{"discussion":` + d + `}}}`
+		}
+		return `{"data":{"node":null}}`
+	}))
+
+	for _, id := range []string{"DC_otherpage", "DC_otherrepo", "DC_missing"} {
+		for name, write := range map[string]http.HandlerFunc{"Edit": h.Edit, "Resolve": h.Resolve} {
+			rec := httptest.NewRecorder()
+			write(rec, signedIn(t, h, "POST", "acme", "octocat", `{"id":"`+id+`","comment":"hi"}`))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s %s through acme/docs/intro = %d, want 404", name, id, rec.Code)
+			}
+		}
+	}
+	if len(changed) != 0 {
+		t.Fatalf("comments elsewhere were changed: %v", changed)
+	}
+
+	// A comment on the page gets past the check, owner and repo in any case.
+	rec := httptest.NewRecorder()
+	h.Resolve(rec, signedIn(t, h, "POST", "acme", "octocat", `{"id":"DC_here"}`))
+	if !slices.Contains(changed, any("DC_here")) {
+		t.Errorf("Resolve DC_here = %d, changed %v", rec.Code, changed)
+	}
+}
+
+func TestMembershipIsCachedPerToken(t *testing.T) {
+	lookups := map[string]int{}
+	h := newTestHandler(t, offline{})
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		lookups[req.Header.Get("Authorization")+" "+req.URL.Path]++
+		status := http.StatusNotFound
+		if strings.HasSuffix(req.URL.Path, "/octocat") {
+			status = http.StatusNoContent
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})}
+
+	for range 3 {
+		for _, login := range []string{"octocat", "OctoCat", "outsider"} {
+			member, err := h.isMember(client, "alice-token", "acme")(login)
+			if err != nil || member != (login != "outsider") {
+				t.Fatalf("isMember(%s) = %v, %v", login, member, err)
+			}
+		}
+	}
+	// Another commenter's token may not see the same private memberships.
+	h.isMember(client, "bob-token", "acme")("octocat")
+
+	want := map[string]int{
+		"bearer alice-token /orgs/acme/members/octocat":  1,
+		"bearer alice-token /orgs/acme/members/outsider": 1,
+		"bearer bob-token /orgs/acme/members/octocat":    1,
+	}
+	if !maps.Equal(lookups, want) {
+		t.Errorf("GitHub lookups = %v, want %v", lookups, want)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,89 @@
+package comments
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/export"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// Export downloads every comment in the repo. Query parameters: format (csv,
+// jsonl or markdown), page, since and until.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	level := CommentPermission(target.Level)
+
+	var githubToken string
+	var viewer *user.User
+	if level == PermissionAnonymous {
+		githubToken = h.GitHubToken
+	} else {
+		var err error
+		githubToken, err = h.userToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		viewer, _ = h.Sessions.User(r)
+	}
+	if !canView(viewer, org, level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format, err := export.ParseFormat(cmp.Or(q.Get("format"), "csv"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := export.Filter{Page: q.Get("page")}
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = export.ParseDate(v, false); err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = export.ParseDate(v, true); err != nil {
+			http.Error(w, fmt.Sprintf("invalid until: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	client := logging.Client(r.Context())
+
+	categoryID := target.CategoryID
+	if categoryID == "" {
+		categoryID, err = utils.FindOrCreateCommentsCategory(client, githubToken, org, repo, cmp.Or(q.Get("category_name"), "General"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	discussions, err := utils.ListPageDiscussions(client, githubToken, org, repo, categoryID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "export failed", "org", org, "repo", repo, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-feedback.%s"`, org, repo, format.Extension()))
+	if err := export.Write(w, format, org, repo, export.Records(discussions, filter)); err != nil {
+		slog.ErrorContext(r.Context(), "export: writing failed", "format", format, "err", err)
+	}
+}
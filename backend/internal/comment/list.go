@@ -0,0 +1,305 @@
+package comments
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
+)
+
+type ListCommentsResponse struct {
+	Comments   []ListedComment `json:"comments"`
+	Total      int             `json:"total"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// ListedComment is a comment along with the labels on its page's discussion.
+// A reply shares its thread's status, so ThreadResolved is what the status
+// filter looks at.
+type ListedComment struct {
+	utils.Comment
+	Labels         []string `json:"labels"`
+	ThreadResolved bool     `json:"threadResolved"`
+}
+
+type listFilter struct {
+	status     string
+	author     string
+	pagePrefix string
+	since      time.Time
+	until      time.Time
+	labels     []string
+}
+
+type listCursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+}
+
+// List returns comments from every page in the repo. Query parameters:
+// status (open, resolved or all), author, page_prefix, since and until
+// (RFC 3339 or YYYY-MM-DD, until is inclusive), label (repeatable, all must
+// match), sort (created, updated or page), order (asc or desc), limit and
+// cursor.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	level := CommentPermission(target.Level)
+
+	var githubToken string
+	var viewer *user.User
+	if level == PermissionAnonymous {
+		githubToken = h.GitHubToken
+	} else {
+		var err error
+		githubToken, err = h.userToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		viewer, _ = h.Sessions.User(r)
+	}
+	if !canView(viewer, org, level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseListFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortBy := cmp.Or(q.Get("sort"), "created")
+	if sortBy != "created" && sortBy != "updated" && sortBy != "page" {
+		http.Error(w, "sort must be created, updated or page", http.StatusBadRequest)
+		return
+	}
+	order := q.Get("order")
+	if order == "" {
+		order = "desc"
+		if sortBy == "page" {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxListLimit)
+	}
+
+	var after *listCursor
+	if v := q.Get("cursor"); v != "" {
+		after, err = decodeListCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	client := logging.Client(r.Context())
+
+	categoryID := target.CategoryID
+	if categoryID == "" {
+		categoryID, err = utils.FindOrCreateCommentsCategory(client, githubToken, org, repo, cmp.Or(q.Get("category_name"), "General"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	discussions, err := utils.ListPageDiscussions(client, githubToken, org, repo, categoryID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing comments failed", "org", org, "repo", repo, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var matched []ListedComment
+	for _, d := range discussions {
+		resolved := map[string]bool{}
+		for _, c := range d.Comments {
+			if c.ReplyTo == "" {
+				resolved[c.ID] = c.Resolved
+			}
+		}
+		for _, c := range d.Comments {
+			listed := ListedComment{Comment: c, Labels: d.Labels, ThreadResolved: resolved[cmp.Or(c.ReplyTo, c.ID)]}
+			if level == PermissionAnonymous {
+				for i := range listed.Reactions {
+					listed.Reactions[i].ViewerHasReacted = false
+				}
+			}
+			if filter.matches(listed) {
+				matched = append(matched, listed)
+			}
+		}
+	}
+
+	key := func(c ListedComment) string {
+		switch sortBy {
+		case "updated":
+			return c.UpdatedAt
+		case "page":
+			return c.Page + "\x00" + c.CreatedAt
+		default:
+			return c.CreatedAt
+		}
+	}
+	compare := func(a, b listCursor) int {
+		n := cmp.Or(strings.Compare(a.Key, b.Key), strings.Compare(a.ID, b.ID))
+		if order == "desc" {
+			return -n
+		}
+		return n
+	}
+	slices.SortFunc(matched, func(a, b ListedComment) int {
+		return compare(listCursor{key(a), a.ID}, listCursor{key(b), b.ID})
+	})
+
+	start := 0
+	if after != nil {
+		start, _ = slices.BinarySearchFunc(matched, *after, func(c ListedComment, target listCursor) int {
+			if compare(listCursor{key(c), c.ID}, target) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	end := min(start+limit, len(matched))
+
+	resp := ListCommentsResponse{
+		Comments: append([]ListedComment{}, matched[start:end]...),
+		Total:    len(matched),
+	}
+	if end < len(matched) {
+		last := matched[end-1]
+		resp.NextCursor = encodeListCursor(listCursor{key(last), last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func parseListFilter(q url.Values) (listFilter, error) {
+	f := listFilter{
+		status:     cmp.Or(q.Get("status"), "all"),
+		author:     q.Get("author"),
+		pagePrefix: q.Get("page_prefix"),
+		labels:     q["label"],
+	}
+	if f.status != "open" && f.status != "resolved" && f.status != "all" {
+		return f, errors.New("status must be open, resolved or all")
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.since, _, err = parseListTime(v); err != nil {
+			return f, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		var dateOnly bool
+		if f.until, dateOnly, err = parseListTime(v); err != nil {
+			return f, fmt.Errorf("invalid until: %v", err)
+		}
+		if dateOnly {
+			f.until = f.until.AddDate(0, 0, 1)
+		}
+	}
+	return f, nil
+}
+
+func parseListTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
+func (f listFilter) matches(c ListedComment) bool {
+	switch f.status {
+	case "open":
+		if c.ThreadResolved {
+			return false
+		}
+	case "resolved":
+		if !c.ThreadResolved {
+			return false
+		}
+	}
+	if f.author != "" && !strings.EqualFold(c.User, f.author) {
+		return false
+	}
+	if !strings.HasPrefix(c.Page, f.pagePrefix) {
+		return false
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		created, err := time.Parse(time.RFC3339, c.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if !f.since.IsZero() && created.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && !created.Before(f.until) {
+			return false
+		}
+	}
+	for _, label := range f.labels {
+		if !slices.ContainsFunc(c.Labels, func(l string) bool { return strings.EqualFold(l, label) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeListCursor(c listCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c listCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
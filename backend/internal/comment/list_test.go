@@ -0,0 +1,128 @@
+package comments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeThread is a top-level comment on page. Replies aren't needed: the
+// list treats them like any other comment.
+type fakeThread struct {
+	id, page, created, updated string
+}
+
+// listDiscussions answers ListPageDiscussions with one discussion per page.
+func listDiscussions(threads *[]fakeThread) graphQL {
+	return func(query string, _ map[string]any) string {
+		byPage := map[string][]string{}
+		var pages []string
+		for _, c := range *threads {
+			if _, ok := byPage[c.page]; !ok {
+				pages = append(pages, c.page)
+			}
+			byPage[c.page] = append(byPage[c.page], fmt.Sprintf(
+				`{"id":%q,"body":"hi","author":{"login":"octocat"},"createdAt":%q,"updatedAt":%q,"replies":{"nodes":[]}}`,
+				c.id, c.created, c.updated))
+		}
+		var discussions []string
+		for _, page := range pages {
+			discussions = append(discussions, fmt.Sprintf(
+				`{"id":"D%s","title":"Page: %s","labels":{"nodes":[]},"comments":{"pageInfo":{"hasNextPage":false},"nodes":[%s]}}`,
+				page, page, strings.Join(byPage[page], ",")))
+		}
+		return `{"data":{"repository":{"discussions":{"pageInfo":{"hasNextPage":false},"nodes":[` + strings.Join(discussions, ",") + `]}}}}`
+	}
+}
+
+func list(t *testing.T, h *Handler, params url.Values) (ListCommentsResponse, int) {
+	t.Helper()
+	params.Set("permission_level", "anon")
+	params.Set("category_id", "C")
+	r := httptest.NewRequest("GET", "/acme/docs/comments?"+params.Encode(), nil)
+	r.SetPathValue("org", "acme")
+	r.SetPathValue("repo", "docs")
+	rec := httptest.NewRecorder()
+	h.List(rec, r)
+
+	var resp ListCommentsResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, rec.Code
+}
+
+// walk follows nextCursor from the first page to the last, limit at a time.
+func walk(t *testing.T, h *Handler, sort string, limit int, between func()) []string {
+	t.Helper()
+	var ids []string
+	params := url.Values{"sort": {sort}, "limit": {fmt.Sprint(limit)}}
+	for range 20 {
+		resp, code := list(t, h, params)
+		if code != http.StatusOK {
+			t.Fatalf("List sort=%s cursor=%q = %d", sort, params.Get("cursor"), code)
+		}
+		for _, c := range resp.Comments {
+			ids = append(ids, c.ID)
+		}
+		if resp.NextCursor == "" {
+			return ids
+		}
+		params.Set("cursor", resp.NextCursor)
+		if between != nil {
+			between()
+		}
+	}
+	t.Fatal("cursor never ran out")
+	return nil
+}
+
+func TestListCursors(t *testing.T) {
+	threads := []fakeThread{
+		{"c1", "/a", "2026-01-01T00:00:00Z", "2026-01-09T00:00:00Z"},
+		{"c2", "/b", "2026-01-02T00:00:00Z", "2026-01-02T00:00:00Z"},
+		// Created at the same moment: the ID breaks the tie.
+		{"c4", "/a", "2026-01-03T00:00:00Z", "2026-01-03T00:00:00Z"},
+		{"c3", "/b", "2026-01-03T00:00:00Z", "2026-01-05T00:00:00Z"},
+		{"c5", "/a", "2026-01-04T00:00:00Z", "2026-01-04T00:00:00Z"},
+	}
+	h := newTestHandler(t, listDiscussions(&threads))
+	h.GitHubToken = "server-token"
+
+	want := map[string][]string{
+		"created": {"c5", "c4", "c3", "c2", "c1"},
+		"updated": {"c1", "c3", "c5", "c4", "c2"},
+		"page":    {"c1", "c4", "c5", "c2", "c3"},
+	}
+	for sort, order := range want {
+		for _, limit := range []int{1, 2, 3, 5} {
+			if got := walk(t, h, sort, limit, nil); !slices.Equal(got, order) {
+				t.Errorf("sort=%s limit=%d walked %v, want %v", sort, limit, got, order)
+			}
+		}
+	}
+
+	// Comments added while someone is paging sort before the cursor, so
+	// nothing is skipped or shown twice.
+	added := 0
+	got := walk(t, h, "created", 2, func() {
+		added++
+		threads = append(threads, fakeThread{fmt.Sprintf("n%d", added), "/c", fmt.Sprintf("2026-02-0%dT00:00:00Z", added), "2026-02-01T00:00:00Z"})
+	})
+	if !slices.Equal(got, want["created"]) {
+		t.Errorf("walk while commenting = %v, want %v", got, want["created"])
+	}
+
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, code := list(t, h, url.Values{"cursor": {cursor}}); code != http.StatusBadRequest {
+			t.Errorf("cursor %q = %d, want 400", cursor, code)
+		}
+	}
+}
@@ -3,8 +3,9 @@ package comments
 import (
 	"encoding/json"
 	"net/http"
-	"os"
 
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
 	"github.com/NicholasRucinski/commentasaurus/internal/user"
 	"github.com/NicholasRucinski/commentasaurus/internal/utils"
 )
@@ -19,7 +20,17 @@ const (
 
 func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
 
-	githubToken := os.Getenv("GITHUB_TOKEN")
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	if target.Site != nil {
+		// Resolve has already looked the IDs up.
+		writeSetup(w, target.CategoryID, target.RepoID)
+		return
+	}
+
+	githubToken := h.GitHubToken
 	if githubToken == "" {
 		http.Error(w, "Missing GitHub config", http.StatusInternalServerError)
 		return
@@ -33,7 +44,7 @@ func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
 	org := r.PathValue("org")
 	repo := r.PathValue("repo")
 
-	client := &http.Client{}
+	client := logging.Client(r.Context())
 
 	categoryId, err := utils.FindOrCreateCommentsCategory(client, githubToken, org, repo, categoryName)
 	if err != nil {
@@ -47,6 +58,10 @@ func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeSetup(w, categoryId, repositoryId)
+}
+
+func writeSetup(w http.ResponseWriter, categoryId, repositoryId string) {
 	ret := struct {
 		CategoryId   string
 		RepositoryId string
@@ -74,6 +89,14 @@ func (h *Handler) Permissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	if target.Site != nil {
+		body.PermissionLevel = CommentPermission(target.Level)
+	}
+
 	switch body.PermissionLevel {
 	case PermissionAnonymous:
 		w.WriteHeader(http.StatusOK)
@@ -92,3 +115,31 @@ func (h *Handler) Permissions(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// canView reports whether viewer may read comments on a page in org that is
+// configured with the given permission level. viewer is nil when the request
+// has no session.
+func canView(viewer *user.User, org string, level CommentPermission) bool {
+	switch level {
+	case PermissionAnonymous:
+		return true
+	case PermissionTeamOnly:
+		return viewer != nil && viewer.IsInOrg([]string{org})
+	default:
+		return viewer != nil
+	}
+}
+
+// siteAllows applies a registered site's permission level to requests that
+// don't otherwise check it. Requests without a site keep their old rules.
+func (h *Handler) siteAllows(w http.ResponseWriter, r *http.Request, target sites.Target) bool {
+	if target.Site == nil {
+		return true
+	}
+	viewer, _ := h.Sessions.User(r)
+	if !canView(viewer, target.Site.Org, CommentPermission(target.Level)) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
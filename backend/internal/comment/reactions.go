@@ -0,0 +1,63 @@
+package comments
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type ReactionRequest struct {
+	Content string `json:"content"`
+}
+
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	var req ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	h.updateReaction(w, r, "reaction.add", req.Content, utils.AddReaction)
+}
+
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	h.updateReaction(w, r, "reaction.remove", r.PathValue("content"), utils.RemoveReaction)
+}
+
+type reactionFunc func(client *http.Client, githubToken, commentID, content string) ([]utils.Reaction, error)
+
+func (h *Handler) updateReaction(w http.ResponseWriter, r *http.Request, action, content string, update reactionFunc) {
+	target, ok := h.target(w, r)
+	if !ok || !h.siteAllows(w, r, target) || h.banned(w, r, r.PathValue("org")) {
+		return
+	}
+
+	githubToken, err := h.userToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	reaction, ok := utils.NormalizeReaction(content)
+	if !ok {
+		http.Error(w, "Unknown reaction", http.StatusBadRequest)
+		return
+	}
+
+	client := logging.Client(r.Context())
+
+	reactions, err := update(client, githubToken, r.PathValue("id"), reaction)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update reaction", "comment", r.PathValue("id"), "reaction", reaction, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, action, r.PathValue("id"), r.PathValue("org"), r.PathValue("repo"), r.PathValue("page"), audit.Change{After: audit.Hash(reactions)})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reactions)
+}
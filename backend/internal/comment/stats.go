@@ -0,0 +1,265 @@
+package comments
+
+import (
+	"cmp"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const statsTTL = 5 * time.Minute
+
+type Stats struct {
+	Pages   []PageStats   `json:"pages"`
+	Authors []AuthorStats `json:"authors"`
+	// MedianTimeToResolve is in seconds and null until a thread is resolved.
+	MedianTimeToResolve *int64            `json:"medianTimeToResolve"`
+	Interval            string            `json:"interval"`
+	Histogram           []HistogramBucket `json:"histogram"`
+	GeneratedAt         time.Time         `json:"generatedAt"`
+}
+
+// PageStats counts threads by status. Comments also includes replies.
+type PageStats struct {
+	Page     string `json:"page"`
+	Open     int    `json:"open"`
+	Resolved int    `json:"resolved"`
+	Comments int    `json:"comments"`
+}
+
+type AuthorStats struct {
+	User     string `json:"user"`
+	Comments int    `json:"comments"`
+}
+
+type HistogramBucket struct {
+	Start    string `json:"start"`
+	Created  int    `json:"created"`
+	Resolved int    `json:"resolved"`
+}
+
+type statsKey struct {
+	org, repo, categoryID string
+}
+
+type statsEntry struct {
+	discussions []utils.PageDiscussion
+	fetchedAt   time.Time
+}
+
+// statsCache holds the raw discussions rather than computed stats so every
+// histogram interval can be served from the same fetch.
+var statsCache = struct {
+	sync.Mutex
+	entries map[statsKey]statsEntry
+}{entries: map[statsKey]statsEntry{}}
+
+// Stats summarises a repo's comments: open and resolved threads per page,
+// comments per author, median time to resolve and a histogram of activity.
+// interval is day or week (the default).
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	level := CommentPermission(target.Level)
+
+	var githubToken string
+	var viewer *user.User
+	if level == PermissionAnonymous {
+		githubToken = h.GitHubToken
+	} else {
+		var err error
+		githubToken, err = h.userToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		viewer, _ = h.Sessions.User(r)
+	}
+	if !canView(viewer, org, level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	interval := cmp.Or(q.Get("interval"), "week")
+	if interval != "day" && interval != "week" {
+		http.Error(w, "interval must be day or week", http.StatusBadRequest)
+		return
+	}
+
+	client := logging.Client(r.Context())
+
+	var err error
+	categoryID := target.CategoryID
+	if categoryID == "" {
+		categoryID, err = utils.FindOrCreateCommentsCategory(client, githubToken, org, repo, cmp.Or(q.Get("category_name"), "General"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	key := statsKey{org, repo, categoryID}
+	statsCache.Lock()
+	entry, ok := statsCache.entries[key]
+	statsCache.Unlock()
+
+	fresh := ok && time.Since(entry.fetchedAt) < statsTTL
+	metrics.CacheLookup("stats", fresh)
+
+	if fresh && level != PermissionAnonymous {
+		// The cache may have been filled using someone else's token, so
+		// check this viewer can see the repository too.
+		if _, err := utils.GetRepositoryID(client, githubToken, org, repo); err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if !fresh {
+		discussions, err := utils.ListPageDiscussions(client, githubToken, org, repo, categoryID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "loading stats failed", "org", org, "repo", repo, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry = statsEntry{discussions: discussions, fetchedAt: time.Now()}
+
+		statsCache.Lock()
+		statsCache.entries[key] = entry
+		statsCache.Unlock()
+	}
+
+	stats := computeStats(entry.discussions, interval)
+	stats.GeneratedAt = entry.fetchedAt.UTC()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func computeStats(discussions []utils.PageDiscussion, interval string) Stats {
+	stats := Stats{
+		Pages:     []PageStats{},
+		Authors:   []AuthorStats{},
+		Interval:  interval,
+		Histogram: []HistogramBucket{},
+	}
+
+	authors := map[string]int{}
+	buckets := map[time.Time]*HistogramBucket{}
+	bucket := func(ts string) *HistogramBucket {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil
+		}
+		start := bucketStart(t, interval)
+		if buckets[start] == nil {
+			buckets[start] = &HistogramBucket{Start: start.Format(time.DateOnly)}
+		}
+		return buckets[start]
+	}
+
+	var resolveTimes []int64
+	for _, d := range discussions {
+		page := PageStats{Page: d.Page}
+		for _, c := range d.Comments {
+			page.Comments++
+			if c.User != "" {
+				authors[c.User]++
+			}
+			if b := bucket(c.CreatedAt); b != nil {
+				b.Created++
+			}
+			if c.ReplyTo != "" {
+				continue
+			}
+			if !c.Resolved {
+				page.Open++
+				continue
+			}
+			page.Resolved++
+
+			// Comments resolved before resolvedAt was recorded fall back to
+			// their last update, which is normally the resolve itself.
+			resolvedAt := cmp.Or(c.ResolvedAt, c.UpdatedAt)
+			if b := bucket(resolvedAt); b != nil {
+				b.Resolved++
+			}
+			created, err1 := time.Parse(time.RFC3339, c.CreatedAt)
+			resolved, err2 := time.Parse(time.RFC3339, resolvedAt)
+			if err1 == nil && err2 == nil && !resolved.Before(created) {
+				resolveTimes = append(resolveTimes, int64(resolved.Sub(created).Seconds()))
+			}
+		}
+		stats.Pages = append(stats.Pages, page)
+	}
+
+	slices.SortFunc(stats.Pages, func(a, b PageStats) int {
+		return cmp.Or(cmp.Compare(b.Open, a.Open), cmp.Compare(a.Page, b.Page))
+	})
+
+	for login, n := range authors {
+		stats.Authors = append(stats.Authors, AuthorStats{User: login, Comments: n})
+	}
+	slices.SortFunc(stats.Authors, func(a, b AuthorStats) int {
+		return cmp.Or(cmp.Compare(b.Comments, a.Comments), cmp.Compare(a.User, b.User))
+	})
+
+	if n := len(resolveTimes); n > 0 {
+		slices.Sort(resolveTimes)
+		median := resolveTimes[n/2]
+		if n%2 == 0 {
+			median = (resolveTimes[n/2-1] + resolveTimes[n/2]) / 2
+		}
+		stats.MedianTimeToResolve = &median
+	}
+
+	// Fill in quiet periods so the histogram can be plotted directly.
+	if len(buckets) > 0 {
+		starts := make([]time.Time, 0, len(buckets))
+		for start := range buckets {
+			starts = append(starts, start)
+		}
+		first, last := slices.MinFunc(starts, time.Time.Compare), slices.MaxFunc(starts, time.Time.Compare)
+		for t := first; !t.After(last); t = nextBucket(t, interval) {
+			if b := buckets[t]; b != nil {
+				stats.Histogram = append(stats.Histogram, *b)
+			} else {
+				stats.Histogram = append(stats.Histogram, HistogramBucket{Start: t.Format(time.DateOnly)})
+			}
+		}
+	}
+
+	return stats
+}
+
+// bucketStart truncates t to the start of its UTC day, or of its week
+// starting on Monday.
+func bucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == "week" {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+func nextBucket(t time.Time, interval string) time.Time {
+	if interval == "week" {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
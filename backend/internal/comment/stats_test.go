@@ -0,0 +1,97 @@
+package comments
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+func TestComputeStats(t *testing.T) {
+	seconds := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name        string
+		interval    string
+		discussions []utils.PageDiscussion
+		want        Stats
+	}{
+		{
+			name:     "empty",
+			interval: "day",
+			want: Stats{
+				Pages:     []PageStats{},
+				Authors:   []AuthorStats{},
+				Interval:  "day",
+				Histogram: []HistogramBucket{},
+			},
+		},
+		{
+			name:     "even count median and day gaps",
+			interval: "day",
+			discussions: []utils.PageDiscussion{
+				{Page: "/b", Comments: []utils.Comment{
+					// Resolved before resolvedAt existed: falls back to updatedAt.
+					{ID: "c4", User: "bob", Resolved: true, CreatedAt: "2026-03-05T00:00:00Z", UpdatedAt: "2026-03-05T02:00:00Z"},
+				}},
+				{Page: "/a", Comments: []utils.Comment{
+					{ID: "c1", User: "alice", Resolved: true, CreatedAt: "2026-03-02T10:00:00Z", ResolvedAt: "2026-03-02T11:00:00Z"},
+					{ID: "c2", User: "bob", ReplyTo: "c1", CreatedAt: "2026-03-02T12:00:00Z"},
+					{ID: "c3", User: "alice", CreatedAt: "2026-03-04T09:00:00Z"},
+				}},
+			},
+			want: Stats{
+				Pages: []PageStats{
+					{Page: "/a", Open: 1, Resolved: 1, Comments: 3},
+					{Page: "/b", Open: 0, Resolved: 1, Comments: 1},
+				},
+				Authors: []AuthorStats{
+					{User: "alice", Comments: 2},
+					{User: "bob", Comments: 2},
+				},
+				MedianTimeToResolve: seconds(5400),
+				Interval:            "day",
+				Histogram: []HistogramBucket{
+					{Start: "2026-03-02", Created: 2, Resolved: 1},
+					{Start: "2026-03-03"},
+					{Start: "2026-03-04", Created: 1},
+					{Start: "2026-03-05", Created: 1, Resolved: 1},
+				},
+			},
+		},
+		{
+			name:     "odd count median and week gaps",
+			interval: "week",
+			discussions: []utils.PageDiscussion{
+				{Page: "/a", Comments: []utils.Comment{
+					{ID: "c1", User: "alice", Resolved: true, CreatedAt: "2026-03-01T23:00:00Z", ResolvedAt: "2026-03-01T23:00:10Z"},
+					{ID: "c2", User: "alice", Resolved: true, CreatedAt: "2026-03-16T00:00:00Z", ResolvedAt: "2026-03-16T00:05:00Z"},
+					{ID: "c3", Resolved: true, CreatedAt: "2026-03-16T00:00:00Z", ResolvedAt: "2026-03-16T00:00:20Z"},
+					// Resolved before it was created: left out of the median.
+					{ID: "c4", Resolved: true, CreatedAt: "2026-03-16T00:00:00Z", ResolvedAt: "2026-03-15T00:00:00Z"},
+				}},
+			},
+			want: Stats{
+				Pages:               []PageStats{{Page: "/a", Resolved: 4, Comments: 4}},
+				Authors:             []AuthorStats{{User: "alice", Comments: 2}},
+				MedianTimeToResolve: seconds(20),
+				Interval:            "week",
+				Histogram: []HistogramBucket{
+					{Start: "2026-02-23", Created: 1, Resolved: 1},
+					{Start: "2026-03-02"},
+					{Start: "2026-03-09", Resolved: 1},
+					{Start: "2026-03-16", Created: 3, Resolved: 2},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeStats(tt.discussions, tt.interval)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computeStats() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
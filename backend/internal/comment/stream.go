@@ -0,0 +1,140 @@
+package comments
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+)
+
+const (
+	heartbeatInterval = 20 * time.Second
+	streamWriteWait   = 10 * time.Second
+)
+
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	if h.Events == nil {
+		http.Error(w, "streaming not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+	page := r.PathValue("page")
+
+	target, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+	level := CommentPermission(target.Level)
+
+	var viewer *user.User
+	if level != PermissionAnonymous {
+		viewer, _ = h.Sessions.User(r)
+	}
+	if !canView(viewer, org, level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter := func(e events.Event) bool {
+		return e.Org == org && e.Repo == repo && e.Page == page
+	}
+
+	sub, replay, complete := h.Events.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout, so each write gets its
+	// own deadline instead.
+	rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	metrics.SSEConnections.Inc()
+	defer metrics.SSEConnections.Dec()
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		// Events after lastID have been evicted, the client has to refetch.
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "stream: flushing not supported", "err", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if sessionExpired(viewer) {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if sessionExpired(viewer) {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+func sessionExpired(viewer *user.User) bool {
+	return viewer != nil && !viewer.ExpiresAt.IsZero() && time.Now().After(viewer.ExpiresAt)
+}
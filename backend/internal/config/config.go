@@ -0,0 +1,436 @@
+// Package config loads the server's settings from a YAML file, environment
+// variables and command line flags. Later sources win: flags override the
+// environment, which overrides the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CookieKeySize is the length COOKIE_KEY must have. It is used as an AES-256
+// key for the github_token cookie.
+const CookieKeySize = 32
+
+type Config struct {
+	Port           int      `yaml:"port"`
+	LogLevel       string   `yaml:"log_level"`
+	DatabasePath   string   `yaml:"database_path"`
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// CookieDomain is set on session cookies outside localhost, for sites
+	// that don't set their own.
+	CookieDomain string   `yaml:"cookie_domain"`
+	CookieKey    string   `yaml:"cookie_key"`
+	JWTSecret    string   `yaml:"jwt_secret"`
+	AdminUsers   []string `yaml:"admin_users"`
+	GitHub       GitHub   `yaml:"github"`
+	Notify       Notify   `yaml:"notify"`
+	Server       Server   `yaml:"server"`
+	Audit        Audit    `yaml:"audit"`
+	// Sites registered here can't be changed through the admin API.
+	Sites []Site `yaml:"sites"`
+	// MetricsToken, when set, must be sent as a bearer token to read
+	// /metrics.
+	MetricsToken string `yaml:"metrics_token"`
+}
+
+// Server tunes the HTTP server. Durations are written like "30s" or "2m".
+type Server struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// WriteTimeout doesn't apply to comment streams, which hold their
+	// connection open.
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TLSCert and TLSKey serve HTTPS directly. The files are reloaded when
+	// they change or on SIGHUP.
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+}
+
+type GitHub struct {
+	// Token is used for anonymous readers and server-side jobs.
+	Token         string `yaml:"token"`
+	WebhookSecret string `yaml:"webhook_secret"`
+	OAuthClientID string `yaml:"oauth_client_id"`
+	OAuthSecret   string `yaml:"oauth_secret"`
+}
+
+type Notify struct {
+	Notifier       string `yaml:"notifier"`
+	WebhookURL     string `yaml:"webhook_url"`
+	TemplateDir    string `yaml:"template_dir"`
+	ChatRoutesFile string `yaml:"chat_routes_file"`
+	SMTP           SMTP   `yaml:"smtp"`
+}
+
+type Audit struct {
+	// Sink is "sql" to keep the log in the database or "file" to append
+	// JSON lines to File.
+	Sink string `yaml:"sink"`
+	File string `yaml:"file"`
+	// RetentionDays is how long entries are kept. Zero keeps them forever.
+	RetentionDays int `yaml:"retention_days"`
+}
+
+// Site is a Docusaurus site served by this deployment. CategoryID and RepoID
+// are looked up from GitHub when left out.
+type Site struct {
+	ID              string   `yaml:"id"`
+	Org             string   `yaml:"org"`
+	Repo            string   `yaml:"repo"`
+	Category        string   `yaml:"category"`
+	CategoryID      string   `yaml:"category_id"`
+	RepoID          string   `yaml:"repo_id"`
+	PermissionLevel string   `yaml:"permission_level"`
+	AllowedOrigins  []string `yaml:"allowed_origins"`
+	CookieDomain    string   `yaml:"cookie_domain"`
+}
+
+type SMTP struct {
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+func Default() *Config {
+	return &Config{
+		Port:         8080,
+		LogLevel:     "info",
+		DatabasePath: "commentasaurus.db",
+		Audit:        Audit{Sink: "sql", RetentionDays: 365},
+		Server: Server{
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    64 << 10,
+			ShutdownTimeout:   30 * time.Second,
+		},
+	}
+}
+
+// Addr is the address the server listens on.
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Load builds the config from defaults, the file named by -config or
+// CONFIG_FILE, the environment and finally the flags in args, which are
+// parsed with fs. The result has been validated.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	configFile := fs.String("config", "", "YAML config file (default $CONFIG_FILE)")
+	port := fs.Int("port", 0, "port to listen on")
+	dbPath := fs.String("db", "", "SQLite database path")
+	origins := fs.String("cors-origins", "", "comma separated origins allowed to call the API")
+	cookieDomain := fs.String("cookie-domain", "", "domain set on session cookies")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file, serves HTTPS with -tls-key")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "db":
+			cfg.DatabasePath = *dbPath
+		case "cors-origins":
+			cfg.AllowedOrigins = splitList(*origins)
+		case "cookie-domain":
+			cfg.CookieDomain = *cookieDomain
+		case "tls-cert":
+			cfg.Server.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.Server.TLSKey = *tlsKey
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"DATABASE_PATH":         &c.DatabasePath,
+		"COOKIE_DOMAIN":         &c.CookieDomain,
+		"COOKIE_KEY":            &c.CookieKey,
+		"JWT_SECRET":            &c.JWTSecret,
+		"GITHUB_TOKEN":          &c.GitHub.Token,
+		"GITHUB_WEBHOOK_SECRET": &c.GitHub.WebhookSecret,
+		"OAUTH_CLIENT_ID":       &c.GitHub.OAuthClientID,
+		"OAUTH_SECRET":          &c.GitHub.OAuthSecret,
+		"NOTIFIER":              &c.Notify.Notifier,
+		"NOTIFY_WEBHOOK_URL":    &c.Notify.WebhookURL,
+		"NOTIFY_TEMPLATE_DIR":   &c.Notify.TemplateDir,
+		"CHAT_ROUTES_FILE":      &c.Notify.ChatRoutesFile,
+		"SMTP_ADDR":             &c.Notify.SMTP.Addr,
+		"SMTP_FROM":             &c.Notify.SMTP.From,
+		"SMTP_USERNAME":         &c.Notify.SMTP.Username,
+		"SMTP_PASSWORD":         &c.Notify.SMTP.Password,
+		"AUDIT_SINK":            &c.Audit.Sink,
+		"AUDIT_FILE":            &c.Audit.File,
+		"LOG_LEVEL":             &c.LogLevel,
+		"METRICS_TOKEN":         &c.MetricsToken,
+		"TLS_CERT_FILE":         &c.Server.TLSCert,
+		"TLS_KEY_FILE":          &c.Server.TLSKey,
+	}
+
+	for name, field := range strs {
+		if v := os.Getenv(name); v != "" {
+			*field = v
+		}
+	}
+
+	if v := os.Getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: PORT must be a number, got %q", v)
+		}
+		c.Port = port
+	}
+	if v := os.Getenv("CORS_ORIGINS"); v != "" {
+		c.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("ADMIN_USERS"); v != "" {
+		c.AdminUsers = splitList(v)
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("config: SHUTDOWN_TIMEOUT must be a duration like 30s, got %q", v)
+		}
+		c.Server.ShutdownTimeout = d
+	}
+	if v := os.Getenv("AUDIT_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: AUDIT_RETENTION_DAYS must be a number, got %q", v)
+		}
+		c.Audit.RetentionDays = days
+	}
+	return nil
+}
+
+// Validate reports every problem with the config at once, so a deploy can be
+// fixed in one go.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		fail("port must be between 1 and 65535, got %d", c.Port)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		fail("log_level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			fail("server.%s can't be negative, got %s", t.name, t.d)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		fail("server.max_header_bytes must be positive, got %d", c.Server.MaxHeaderBytes)
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		fail("server.tls_cert (TLS_CERT_FILE) and server.tls_key (TLS_KEY_FILE) must be set together")
+	}
+	for _, path := range []string{c.Server.TLSCert, c.Server.TLSKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			fail("server: %v", err)
+		}
+	}
+	if c.DatabasePath == "" {
+		fail("database_path (DATABASE_PATH) is required")
+	}
+
+	if len(c.AllowedOrigins) == 0 {
+		fail("allowed_origins (CORS_ORIGINS) needs at least one origin")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if err := ValidateOrigin(origin); err != nil {
+			fail("allowed_origins: %v", err)
+		}
+	}
+	if c.CookieDomain == "" {
+		fail("cookie_domain (COOKIE_DOMAIN) is required")
+	}
+
+	switch n := len(c.CookieKey); {
+	case n == 0:
+		fail("cookie_key (COOKIE_KEY) is required")
+	case n != CookieKeySize:
+		fail("cookie_key (COOKIE_KEY) must be %d bytes, got %d", CookieKeySize, n)
+	}
+	if c.JWTSecret == "" {
+		fail("jwt_secret (JWT_SECRET) is required")
+	}
+	if c.GitHub.OAuthClientID == "" {
+		fail("github.oauth_client_id (OAUTH_CLIENT_ID) is required")
+	}
+	if c.GitHub.OAuthSecret == "" {
+		fail("github.oauth_secret (OAUTH_SECRET) is required")
+	}
+
+	switch c.Notify.Notifier {
+	case "", "github":
+	case "webhook":
+		if c.Notify.WebhookURL == "" {
+			fail("notify.webhook_url (NOTIFY_WEBHOOK_URL) is required when the notifier is webhook")
+		}
+	case "email":
+		if c.Notify.SMTP.Addr == "" {
+			fail("notify.smtp.addr (SMTP_ADDR) is required when the notifier is email")
+		}
+	default:
+		fail("notify.notifier (NOTIFIER) must be github, webhook or email, got %q", c.Notify.Notifier)
+	}
+	if c.Notify.SMTP.Addr != "" && c.Notify.SMTP.From == "" {
+		fail("notify.smtp.from (SMTP_FROM) is required when SMTP is configured")
+	}
+	if c.Notify.ChatRoutesFile != "" {
+		if _, err := os.Stat(c.Notify.ChatRoutesFile); err != nil {
+			fail("notify.chat_routes_file: %v", err)
+		}
+	}
+	if c.Notify.TemplateDir != "" {
+		if info, err := os.Stat(c.Notify.TemplateDir); err != nil {
+			fail("notify.template_dir: %v", err)
+		} else if !info.IsDir() {
+			fail("notify.template_dir: %s is not a directory", c.Notify.TemplateDir)
+		}
+	}
+
+	switch c.Audit.Sink {
+	case "sql":
+	case "file":
+		if c.Audit.File == "" {
+			fail("audit.file (AUDIT_FILE) is required when the audit sink is file")
+		}
+	default:
+		fail("audit.sink (AUDIT_SINK) must be sql or file, got %q", c.Audit.Sink)
+	}
+	if c.Audit.RetentionDays < 0 {
+		fail("audit.retention_days (AUDIT_RETENTION_DAYS) can't be negative, got %d", c.Audit.RetentionDays)
+	}
+
+	seen := map[string]bool{}
+	for i, site := range c.Sites {
+		if site.ID == "" {
+			fail("sites[%d]: id is required", i)
+		} else if seen[site.ID] {
+			fail("sites[%d]: duplicate id %q", i, site.ID)
+		}
+		seen[site.ID] = true
+		if site.Org == "" || site.Repo == "" {
+			fail("sites[%d]: org and repo are required", i)
+		}
+		if err := ValidatePermissionLevel(site.PermissionLevel); err != nil {
+			fail("sites[%d]: %v", i, err)
+		}
+		for _, origin := range site.AllowedOrigins {
+			if err := ValidateOrigin(origin); err != nil {
+				fail("sites[%d]: %v", i, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ValidateOrigin checks origin is a bare http(s) origin as browsers send it.
+func ValidateOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+		return fmt.Errorf("origin %q must look like https://example.com", origin)
+	}
+	return nil
+}
+
+func ValidatePermissionLevel(level string) error {
+	switch level {
+	case "anon", "auth", "team":
+		return nil
+	}
+	return fmt.Errorf("permission_level must be anon, auth or team, got %q", level)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// valid is the smallest config that passes Validate.
+func valid() *Config {
+	c := Default()
+	c.AllowedOrigins = []string{"https://docs.example.com"}
+	c.CookieDomain = ".example.com"
+	c.CookieKey = strings.Repeat("k", CookieKeySize)
+	c.JWTSecret = "jwt"
+	c.GitHub.OAuthClientID = "id"
+	c.GitHub.OAuthSecret = "secret"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"short cookie key", func(c *Config) { c.CookieKey = "short" }, []string{"cookie_key (COOKIE_KEY) must be 32 bytes, got 5"}},
+		{"long cookie key", func(c *Config) { c.CookieKey = strings.Repeat("k", 33) }, []string{"must be 32 bytes, got 33"}},
+		{"missing cookie key", func(c *Config) { c.CookieKey = "" }, []string{"cookie_key (COOKIE_KEY) is required"}},
+		{"bad port", func(c *Config) { c.Port = 70000 }, []string{"port must be between 1 and 65535"}},
+		{"bad origin", func(c *Config) { c.AllowedOrigins = []string{"example.com"} }, []string{`origin "example.com" must look like`}},
+		{"no origins", func(c *Config) { c.AllowedOrigins = nil }, []string{"allowed_origins (CORS_ORIGINS) needs at least one origin"}},
+		{"no cookie domain", func(c *Config) { c.CookieDomain = "" }, []string{"cookie_domain (COOKIE_DOMAIN) is required"}},
+		{"email without smtp", func(c *Config) { c.Notify.Notifier = "email" }, []string{"notify.smtp.addr (SMTP_ADDR) is required"}},
+		{"unknown notifier", func(c *Config) { c.Notify.Notifier = "pigeon" }, []string{`got "pigeon"`}},
+		{"tls cert without key", func(c *Config) { c.Server.TLSCert = "cert.pem" }, []string{"must be set together"}},
+		{"negative retention", func(c *Config) { c.Audit.RetentionDays = -1 }, []string{"can't be negative, got -1"}},
+		{
+			name: "bad sites",
+			change: func(c *Config) {
+				c.Sites = []Site{
+					{ID: "docs", Org: "o", Repo: "r", PermissionLevel: "anon"},
+					{ID: "docs", Org: "o", Repo: "r", PermissionLevel: "everyone"},
+				}
+			},
+			want: []string{`sites[1]: duplicate id "docs"`, "sites[1]: permission_level must be anon, auth or team"},
+		},
+		{
+			name: "every problem at once",
+			change: func(c *Config) {
+				c.CookieKey = "short"
+				c.JWTSecret = ""
+				c.GitHub.OAuthSecret = ""
+			},
+			want: []string{"COOKIE_KEY", "JWT_SECRET", "OAUTH_SECRET"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(c)
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors containing %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, missing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	file := "port: 9000\ndatabase_path: file.db\ncookie_domain: file.example.com\njwt_secret: from-file\nallowed_origins: [https://docs.example.com]\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty variables are ignored, which keeps the host's out of the test.
+	for _, name := range []string{"CONFIG_FILE", "CORS_ORIGINS", "COOKIE_DOMAIN", "JWT_SECRET", "LOG_LEVEL"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("PORT", "9001")
+	t.Setenv("DATABASE_PATH", "env.db")
+	t.Setenv("COOKIE_KEY", strings.Repeat("k", CookieKeySize))
+	t.Setenv("OAUTH_CLIENT_ID", "id")
+	t.Setenv("OAUTH_SECRET", "secret")
+
+	cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path, "-port", "9002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"flag over env", cfg.Port, 9002},
+		{"env over file", cfg.DatabasePath, "env.db"},
+		{"file over default", cfg.CookieDomain, "file.example.com"},
+		{"file only", cfg.JWTSecret, "from-file"},
+		{"default", cfg.LogLevel, "info"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadIgnoresMisspeltClientID(t *testing.T) {
+	for _, name := range []string{"CONFIG_FILE", "OAUTH_CLIENT_ID"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("OAUTH_ClIENT_ID", "id")
+
+	_, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err == nil || !strings.Contains(err.Error(), "github.oauth_client_id (OAUTH_CLIENT_ID) is required") {
+		t.Errorf("Load() = %v, want OAUTH_CLIENT_ID reported missing", err)
+	}
+}
@@ -0,0 +1,184 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type Type string
+
+const (
+	Created  Type = "created"
+	Edited   Type = "edited"
+	Resolved Type = "resolved"
+	Deleted  Type = "deleted"
+)
+
+type Event struct {
+	ID      uint64        `json:"id"`
+	Type    Type          `json:"type"`
+	Org     string        `json:"org"`
+	Repo    string        `json:"repo"`
+	Page    string        `json:"page"`
+	Actor   string        `json:"actor,omitempty"`
+	Comment utils.Comment `json:"comment"`
+	Time    time.Time     `json:"time"`
+}
+
+const subscriberBuffer = 64
+
+// Broker fans comment events out to every subscriber and keeps a bounded
+// history so reconnecting clients can resume from the last ID they saw.
+type Broker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter func(Event) bool
+	broker *Broker
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		nextID:      1,
+		historySize: historySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event an ID and delivers it. The same change is often
+// reported twice, once by our own write and once by the GitHub webhook, so
+// an event matching one already in history is dropped.
+func (b *Broker) Publish(e Event) (Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, prev := range b.history {
+		if prev.Type == e.Type && prev.Comment.ID == e.Comment.ID && prev.Comment.UpdatedAt == e.Comment.UpdatedAt {
+			return prev, false
+		}
+	}
+
+	e.ID = b.nextID
+	b.nextID++
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// A subscriber that can't keep up is cut off; SSE clients
+			// reconnect with Last-Event-ID and replay what they missed.
+			b.remove(sub)
+		}
+	}
+
+	return e, true
+}
+
+// Subscribe registers a subscriber for events matching filter. Events with an
+// ID greater than lastID that are still in history are returned as replay.
+// complete is false when events after lastID have already been evicted.
+func (b *Broker) Subscribe(filter func(Event) bool, lastID uint64) (sub *Subscription, replay []Event, complete bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, filter: filter, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID > 0 {
+		if len(b.history) > 0 && b.history[0].ID > lastID+1 {
+			complete = false
+		}
+		for _, e := range b.history {
+			if e.ID > lastID && filter(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// Listen calls fn for every event published after it starts until ctx is
+// done. If fn falls behind and the subscription is cut off, Listen
+// resubscribes and replays whatever is still in history.
+func (b *Broker) Listen(ctx context.Context, fn func(Event)) {
+	all := func(Event) bool { return true }
+
+	b.mu.Lock()
+	lastID := b.nextID - 1
+	b.mu.Unlock()
+
+	for {
+		sub, replay, complete := b.Subscribe(all, lastID)
+		if !complete {
+			slog.Warn("events: listener fell behind, some events were dropped", "after", lastID)
+		}
+		for _, e := range replay {
+			fn(e)
+			lastID = e.ID
+		}
+
+	receive:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					break receive
+				}
+				fn(e)
+				lastID = e.ID
+			}
+		}
+	}
+}
+
+// DisconnectAll closes every subscription. SSE clients reconnect and replay
+// from their last ID; it is used so a shutdown doesn't wait on them.
+func (b *Broker) DisconnectAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.c)
+}
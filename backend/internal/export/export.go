@@ -0,0 +1,195 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type Format string
+
+const (
+	FormatCSV      Format = "csv"
+	FormatJSONL    Format = "jsonl"
+	FormatMarkdown Format = "markdown"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatJSONL, FormatMarkdown:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	case "json":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want csv, jsonl or markdown)", s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/jsonl; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+func (f Format) Extension() string {
+	if f == FormatMarkdown {
+		return "md"
+	}
+	return string(f)
+}
+
+// Filter limits an export to one page and to comments created in
+// [Since, Until). Zero values don't filter.
+type Filter struct {
+	Page  string
+	Since time.Time
+	Until time.Time
+}
+
+// ParseDate accepts RFC 3339 or YYYY-MM-DD. A bare date used as an upper
+// bound covers the whole day.
+func ParseDate(v string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// Record is one exported comment. Replies take their thread's status.
+type Record struct {
+	Page          string `json:"page"`
+	ID            string `json:"id"`
+	ThreadID      string `json:"threadId"`
+	ReplyTo       string `json:"replyTo,omitempty"`
+	User          string `json:"user"`
+	Status        string `json:"status"`
+	ContextBefore string `json:"contextBefore"`
+	Text          string `json:"text"`
+	ContextAfter  string `json:"contextAfter"`
+	Comment       string `json:"comment"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+	ResolvedAt    string `json:"resolvedAt,omitempty"`
+}
+
+// Records flattens discussions into thread order, dropping anything the
+// filter excludes. A reply is kept whenever it matches, even if the comment
+// it answers falls outside the date range.
+func Records(discussions []utils.PageDiscussion, filter Filter) []Record {
+	var records []Record
+	for _, d := range discussions {
+		if filter.Page != "" && d.Page != filter.Page {
+			continue
+		}
+
+		status := map[string]string{}
+		resolvedAt := map[string]string{}
+		for _, c := range d.Comments {
+			if c.ReplyTo == "" {
+				status[c.ID] = "open"
+				if c.Resolved {
+					status[c.ID] = "resolved"
+					resolvedAt[c.ID] = c.ResolvedAt
+				}
+			}
+		}
+
+		for _, c := range d.Comments {
+			if !filter.includes(c.CreatedAt) {
+				continue
+			}
+			thread := c.ReplyTo
+			if thread == "" {
+				thread = c.ID
+			}
+			records = append(records, Record{
+				Page:          d.Page,
+				ID:            c.ID,
+				ThreadID:      thread,
+				ReplyTo:       c.ReplyTo,
+				User:          c.User,
+				Status:        status[thread],
+				ContextBefore: c.BeforeContext,
+				Text:          c.Text,
+				ContextAfter:  c.AfterContext,
+				Comment:       c.Comment,
+				CreatedAt:     c.CreatedAt,
+				UpdatedAt:     c.UpdatedAt,
+				ResolvedAt:    resolvedAt[thread],
+			})
+		}
+	}
+	return records
+}
+
+func (f Filter) includes(createdAt string) bool {
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false
+	}
+	return (f.Since.IsZero() || !t.Before(f.Since)) && (f.Until.IsZero() || t.Before(f.Until))
+}
+
+// Write renders records for org/repo in the given format.
+func Write(w io.Writer, format Format, org, repo string, records []Record) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, records)
+	case FormatJSONL:
+		return writeJSONL(w, records)
+	case FormatMarkdown:
+		return writeMarkdown(w, org, repo, records)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+func writeCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"page", "id", "thread_id", "reply_to", "user", "status", "context_before", "text", "context_after", "comment", "created_at", "updated_at", "resolved_at"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{safeCell(r.Page), r.ID, r.ThreadID, r.ReplyTo, safeCell(r.User), r.Status, safeCell(r.ContextBefore), safeCell(r.Text), safeCell(r.ContextAfter), safeCell(r.Comment), r.CreatedAt, r.UpdatedAt, r.ResolvedAt}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// safeCell stops spreadsheets from running user-written text as a formula
+// by prefixing cells that start with a formula character with a quote.
+func safeCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func writeJSONL(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
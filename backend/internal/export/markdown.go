@@ -0,0 +1,61 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMarkdown groups records by page. Each comment quotes the selection it
+// is anchored to, with the selected text in bold, and replies are nested
+// under the comment they answer.
+func writeMarkdown(w io.Writer, org, repo string, records []Record) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# Feedback for %s/%s\n\n", org, repo)
+	fmt.Fprintf(bw, "%d comments\n", len(records))
+
+	page := ""
+	for i, r := range records {
+		if i == 0 || r.Page != page {
+			page = r.Page
+			fmt.Fprintf(bw, "\n## %s\n", page)
+		}
+
+		heading := "###"
+		if r.ReplyTo != "" {
+			heading = "####"
+		}
+		author := r.User
+		if author == "" {
+			author = "unknown"
+		}
+		if r.ReplyTo != "" {
+			fmt.Fprintf(bw, "\n%s Reply from @%s\n\n", heading, author)
+		} else {
+			fmt.Fprintf(bw, "\n%s @%s (%s)\n\n", heading, author, r.Status)
+		}
+
+		if r.Text != "" {
+			quote := strings.TrimSpace(r.ContextBefore + "**" + strings.TrimSpace(r.Text) + "**" + r.ContextAfter)
+			for _, line := range strings.Split(quote, "\n") {
+				fmt.Fprintf(bw, "> %s\n", line)
+			}
+			bw.WriteString("\n")
+		}
+
+		fmt.Fprintf(bw, "%s\n\n", strings.TrimSpace(r.Comment))
+
+		times := []string{"Created " + r.CreatedAt}
+		if r.UpdatedAt != "" && r.UpdatedAt != r.CreatedAt {
+			times = append(times, "updated "+r.UpdatedAt)
+		}
+		if r.ReplyTo == "" && r.ResolvedAt != "" {
+			times = append(times, "resolved "+r.ResolvedAt)
+		}
+		fmt.Fprintf(bw, "_%s_\n", strings.Join(times, " · "))
+	}
+
+	return bw.Flush()
+}
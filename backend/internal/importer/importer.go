@@ -0,0 +1,322 @@
+// Package importer moves comments from giscus and utterances threads into
+// Commentasaurus discussions.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type Source string
+
+const (
+	Giscus     Source = "giscus"
+	Utterances Source = "utterances"
+)
+
+// Mapping says how the old system titled its threads. Titles listed in
+// Options.Titles are always looked up there first.
+type Mapping string
+
+const (
+	MappingPathname Mapping = "pathname"
+	MappingURL      Mapping = "url"
+	MappingTitle    Mapping = "title"
+)
+
+type Options struct {
+	Source  Source
+	Mapping Mapping
+	// Titles maps thread titles to page IDs for mappings that can't be
+	// derived from the title alone, such as page titles.
+	Titles map[string]string
+	// Rewrite converts giscus discussions in place, keeping the original
+	// authors, instead of re-creating their comments. It needs the source
+	// and target to be the same repository.
+	Rewrite bool
+	// Resolve marks every imported thread resolved, including ones
+	// imported or rewritten by an earlier run.
+	Resolve bool
+	DryRun  bool
+	Log     io.Writer
+}
+
+// Importer writes into the comment category of one repository.
+type Importer struct {
+	Client     *http.Client
+	Token      string
+	Org        string
+	Repo       string
+	CategoryID string
+	RepoID     string
+}
+
+type Result struct {
+	Threads  int
+	Imported int
+	Skipped  int
+	Resolved int
+	Unmapped []string
+}
+
+// PageFor maps a thread title to the page ID Commentasaurus uses, which is
+// the page's pathname with a leading slash.
+func PageFor(title string, mapping Mapping, titles map[string]string) (string, bool) {
+	if page, ok := titles[title]; ok {
+		return page, true
+	}
+
+	switch mapping {
+	case MappingPathname:
+		title = strings.TrimSpace(title)
+		if title == "" {
+			return "", false
+		}
+		return "/" + strings.TrimLeft(title, "/"), true
+	case MappingURL:
+		u, err := url.Parse(strings.TrimSpace(title))
+		if err != nil || u.Path == "" {
+			return "", false
+		}
+		return u.Path, true
+	}
+	return "", false
+}
+
+// Run imports threads. Comments imported by an earlier run are recognised by
+// their importedFrom metadata and left alone, so Run can be repeated safely.
+func (im *Importer) Run(threads []utils.ExternalThread, opts Options) (Result, error) {
+	logf := func(format string, args ...any) {
+		if opts.Log != nil {
+			fmt.Fprintf(opts.Log, format+"\n", args...)
+		}
+	}
+
+	if opts.Rewrite && opts.Source != Giscus {
+		return Result{}, fmt.Errorf("only giscus discussions can be rewritten in place")
+	}
+
+	existing, err := utils.ListPageDiscussions(im.Client, im.Token, im.Org, im.Repo, im.CategoryID)
+	if err != nil {
+		return Result{}, fmt.Errorf("listing existing comments: %w", err)
+	}
+	imported := map[string]utils.Comment{}
+	pages := map[string]bool{}
+	for _, d := range existing {
+		pages[d.Page] = true
+		for _, c := range d.Comments {
+			if c.ImportedFrom != "" {
+				imported[c.ImportedFrom] = c
+			}
+		}
+	}
+
+	var res Result
+	for _, thread := range threads {
+		if strings.HasPrefix(thread.Title, "Page: ") {
+			// Already one of ours, e.g. rewritten by an earlier run.
+			continue
+		}
+		page, ok := PageFor(thread.Title, opts.Mapping, opts.Titles)
+		if !ok {
+			res.Unmapped = append(res.Unmapped, thread.Title)
+			logf("skip %q: no page mapping", thread.Title)
+			continue
+		}
+		if len(thread.Comments) == 0 {
+			continue
+		}
+		res.Threads++
+
+		if opts.Rewrite && !pages[page] {
+			logf("rewrite %q as %s (%d comments)", thread.Title, page, countComments(thread.Comments))
+			if opts.DryRun {
+				res.Imported += countComments(thread.Comments)
+				if opts.Resolve {
+					res.Resolved += len(thread.Comments)
+				}
+			} else if err := im.rewrite(thread, page, opts, &res); err != nil {
+				return res, err
+			}
+			pages[page] = true
+			continue
+		}
+		if opts.Rewrite {
+			logf("%s already has a discussion, re-creating %q instead of rewriting", page, thread.Title)
+		}
+
+		logf("import %q as %s (%d comments)", thread.Title, page, countComments(thread.Comments))
+		if opts.DryRun {
+			n := countNew(thread.Comments, imported)
+			res.Imported += n
+			res.Skipped += countComments(thread.Comments) - n
+			if opts.Resolve {
+				res.Resolved += countNew(topLevel(thread.Comments), imported)
+			}
+			continue
+		}
+		if err := im.recreate(thread, page, imported, opts, &res); err != nil {
+			return res, err
+		}
+		pages[page] = true
+	}
+
+	if opts.Resolve {
+		// Anything imported by an earlier run that is still open.
+		for _, prev := range imported {
+			if prev.Resolved || prev.ReplyTo != "" {
+				continue
+			}
+			logf("resolve %s on %s", prev.ID, prev.Page)
+			if opts.DryRun {
+				res.Resolved++
+				continue
+			}
+			if _, err := utils.UpdateComment(im.Client, im.Token, prev.ID, prev.Page); err != nil {
+				return res, fmt.Errorf("resolving %s: %w", prev.ID, err)
+			}
+			res.Resolved++
+		}
+	}
+
+	return res, nil
+}
+
+// recreate posts copies of the thread's comments to the page's discussion.
+// The copies are authored by the importing token, so each one is credited
+// to its original author in the body.
+func (im *Importer) recreate(thread utils.ExternalThread, page string, imported map[string]utils.Comment, opts Options, res *Result) error {
+	discussionID, err := utils.FindOrCreateDiscussion(im.Client, im.Token, im.Org, im.Repo, page, im.CategoryID, im.RepoID)
+	if err != nil {
+		return fmt.Errorf("finding discussion for %s: %w", page, err)
+	}
+
+	var post func(c utils.ExternalComment, replyTo string) error
+	post = func(c utils.ExternalComment, replyTo string) error {
+		id := ""
+		if prev, ok := imported[c.ID]; ok {
+			res.Skipped++
+			id = prev.ID
+		} else {
+			meta := utils.CommentMetadata{Page: page, ImportedFrom: c.ID}
+			if opts.Resolve && replyTo == "" {
+				meta.Resolved = true
+				meta.ResolvedAt = time.Now().UTC().Format(time.RFC3339)
+				res.Resolved++
+			}
+			created, err := utils.CreateComment(im.Client, discussionID, im.Token, attributed(c, opts.Source), meta, replyTo)
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", c.ID, err)
+			}
+			res.Imported++
+			id = created.ID
+		}
+
+		// Discussions only nest one level, so replies to replies are
+		// attached to the top-level comment.
+		parent := replyTo
+		if parent == "" {
+			parent = id
+		}
+		for _, reply := range c.Replies {
+			if err := post(reply, parent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, c := range thread.Comments {
+		if err := post(c, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite turns a giscus discussion into a Commentasaurus one in place: it
+// is retitled, moved into the comment category and each comment gains
+// page-level metadata.
+func (im *Importer) rewrite(thread utils.ExternalThread, page string, opts Options, res *Result) error {
+	if err := utils.MoveDiscussion(im.Client, im.Token, thread.ID, "Page: "+page, im.CategoryID); err != nil {
+		return fmt.Errorf("moving %q: %w", thread.Title, err)
+	}
+
+	var convert func(c utils.ExternalComment, topLevel bool) error
+	convert = func(c utils.ExternalComment, topLevel bool) error {
+		_, err := utils.ModifyComment(im.Client, im.Token, c.ID, page, func(comment *string, meta *utils.CommentMetadata) {
+			meta.Page = page
+			meta.ImportedFrom = c.ID
+			if opts.Resolve && topLevel && !meta.Resolved {
+				meta.Resolved = true
+				meta.ResolvedAt = time.Now().UTC().Format(time.RFC3339)
+				res.Resolved++
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("rewriting %s: %w", c.ID, err)
+		}
+		res.Imported++
+
+		for _, reply := range c.Replies {
+			if err := convert(reply, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, c := range thread.Comments {
+		if err := convert(c, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attributed(c utils.ExternalComment, source Source) string {
+	author := "@" + c.Author
+	if c.Author == "" {
+		author = "a deleted user"
+	}
+	date := c.CreatedAt
+	if t, err := time.Parse(time.RFC3339, c.CreatedAt); err == nil {
+		date = t.Format("January 2, 2006")
+	}
+	return fmt.Sprintf("%s\n\n_Originally posted by %s on %s via %s._", strings.TrimSpace(c.Body), author, date, source)
+}
+
+func countComments(comments []utils.ExternalComment) int {
+	n := len(comments)
+	for _, c := range comments {
+		n += countComments(c.Replies)
+	}
+	return n
+}
+
+// topLevel drops the replies, leaving the comments that start threads.
+func topLevel(comments []utils.ExternalComment) []utils.ExternalComment {
+	threads := make([]utils.ExternalComment, len(comments))
+	for i, c := range comments {
+		c.Replies = nil
+		threads[i] = c
+	}
+	return threads
+}
+
+func countNew(comments []utils.ExternalComment, imported map[string]utils.Comment) int {
+	n := 0
+	for _, c := range comments {
+		if _, ok := imported[c.ID]; !ok {
+			n++
+		}
+		n += countNew(c.Replies, imported)
+	}
+	return n
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// post is one AddDiscussionComment the importer sent.
+type post struct {
+	id, discussion, replyTo, body string
+}
+
+// fakeRepo answers the importer's queries. /intro already has a discussion
+// holding one comment imported from giscus comment G1.
+func fakeRepo(t *testing.T, posts *[]post) *http.Client {
+	imported, _ := json.Marshal("Hello\n\n<!-- commentasaurus:" + `{"version":1,"page":"/intro","importedFrom":"G1"}` + "-->")
+	existing := fmt.Sprintf(`{"data":{"repository":{"discussions":{"pageInfo":{"hasNextPage":false},"nodes":[
+		{"id":"D-intro","title":"Page: /intro","labels":{"nodes":[]},"comments":{"pageInfo":{"hasNextPage":false},"nodes":[
+			{"id":"C-old","body":%s,"author":{"login":"importer"},"createdAt":"2026-01-01T00:00:00Z","updatedAt":"2026-01-01T00:00:00Z","replies":{"nodes":[]}}
+		]}}
+	]}}}}`, imported)
+
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+
+		var resp string
+		switch op := metrics.GraphQLOperation(req.Query); op {
+		case "listPageDiscussions":
+			resp = existing
+		case "search":
+			resp = `{"data":{"search":{"nodes":[{"id":"D-intro","title":"Page: /intro"}]}}}`
+		case "createDiscussion":
+			resp = `{"data":{"createDiscussion":{"discussion":{"id":"D-new","title":"Page: /guide"}}}}`
+		case "addDiscussionComment":
+			replyTo, _ := req.Variables["replyToId"].(string)
+			p := post{
+				id:         fmt.Sprintf("C%d", len(*posts)+1),
+				discussion: req.Variables["discussionId"].(string),
+				replyTo:    replyTo,
+				body:       req.Variables["body"].(string),
+			}
+			*posts = append(*posts, p)
+			resp = fmt.Sprintf(`{"data":{"addDiscussionComment":{"comment":{"id":%q,"body":"","author":{"login":"importer"},"createdAt":"2026-01-01T00:00:00Z","updatedAt":"2026-01-01T00:00:00Z"}}}}`, p.id)
+		default:
+			t.Fatalf("unexpected %s", op)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(resp))}, nil
+	})}
+}
+
+func TestRunRebuildsThreads(t *testing.T) {
+	var posts []post
+	im := &Importer{Client: fakeRepo(t, &posts), Token: "t", Org: "acme", Repo: "docs", CategoryID: "CAT", RepoID: "R"}
+
+	reply := func(id, author string, replies ...utils.ExternalComment) utils.ExternalComment {
+		return utils.ExternalComment{ID: id, Author: author, Body: "body of " + id, CreatedAt: "2024-05-06T10:00:00Z", Replies: replies}
+	}
+	threads := []utils.ExternalThread{
+		// G1 came over last time; its replies didn't.
+		{Title: "intro", Comments: []utils.ExternalComment{
+			reply("G1", "alice", reply("G2", "bob", reply("G3", "carol"))),
+		}},
+		{Title: "/guide/", Comments: []utils.ExternalComment{
+			reply("G4", "", reply("G5", "alice")),
+			reply("G6", "bob"),
+		}},
+		{Title: "Page: /intro", Comments: []utils.ExternalComment{reply("G7", "dave")}},
+		{Title: "   ", Comments: []utils.ExternalComment{reply("G8", "erin")}},
+		{Title: "empty"},
+	}
+
+	var log bytes.Buffer
+	res, err := im.Run(threads, Options{Source: Giscus, Mapping: MappingPathname, Log: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Threads != 2 || res.Imported != 5 || res.Skipped != 1 || !slices.Equal(res.Unmapped, []string{"   "}) {
+		t.Errorf("Run = %+v, want 2 threads, 5 imported, 1 skipped and one unmapped", res)
+	}
+
+	// Replies hang off the top-level comment however deep they were, and
+	// the skipped comment's existing copy stands in for it.
+	want := []struct{ id, discussion, replyTo, from string }{
+		{"C1", "D-intro", "C-old", "G2"},
+		{"C2", "D-intro", "C-old", "G3"},
+		{"C3", "D-new", "", "G4"},
+		{"C4", "D-new", "C3", "G5"},
+		{"C5", "D-new", "", "G6"},
+	}
+	if len(posts) != len(want) {
+		t.Fatalf("posted %d comments, want %d:\n%s", len(posts), len(want), log.String())
+	}
+	for i, p := range posts {
+		w := want[i]
+		if p.id != w.id || p.discussion != w.discussion || p.replyTo != w.replyTo {
+			t.Errorf("post %d = %s in %s replying to %q, want %s in %s replying to %q", i, p.id, p.discussion, p.replyTo, w.id, w.discussion, w.replyTo)
+		}
+		if !strings.HasPrefix(p.body, "body of "+w.from) || !strings.Contains(p.body, `"importedFrom":"`+w.from+`"`) {
+			t.Errorf("post %d body = %q, want %s's with its importedFrom", i, p.body, w.from)
+		}
+	}
+
+	if !strings.Contains(posts[0].body, "Originally posted by @bob on May 6, 2024 via giscus.") {
+		t.Errorf("reply not credited to its author: %q", posts[0].body)
+	}
+	if !strings.Contains(posts[2].body, "Originally posted by a deleted user") {
+		t.Errorf("comment from a deleted account: %q", posts[2].body)
+	}
+}
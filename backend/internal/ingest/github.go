@@ -0,0 +1,151 @@
+package ingest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const maxPayloadSize = 5 << 20
+
+// Handler receives GitHub webhook deliveries so changes made directly on
+// GitHub (edits, deletes, resolves from the Discussions UI) reach the same
+// event stream as writes made through this server.
+type Handler struct {
+	Events *events.Broker
+	// Secret verifies deliveries. Ingestion is off without one.
+	Secret string
+}
+
+type discussionCommentPayload struct {
+	Action  string `json:"action"`
+	Changes struct {
+		Body struct {
+			From string `json:"from"`
+		} `json:"body"`
+	} `json:"changes"`
+	Comment struct {
+		NodeID string `json:"node_id"`
+		Body   string `json:"body"`
+		User   struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+	} `json:"comment"`
+	Discussion struct {
+		Title string `json:"title"`
+	} `json:"discussion"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	Repository struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+}
+
+func (h *Handler) GitHub(w http.ResponseWriter, r *http.Request) {
+	if h.Secret == "" {
+		http.Error(w, "webhook ingestion not configured", http.StatusNotImplemented)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(h.Secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "discussion_comment":
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var payload discussionCommentPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	page, ok := strings.CutPrefix(payload.Discussion.Title, "Page: ")
+	if !ok {
+		// Not one of our discussions.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	comment := utils.NewComment(
+		payload.Comment.NodeID,
+		payload.Comment.Body,
+		payload.Comment.User.Login,
+		payload.Comment.CreatedAt,
+		payload.Comment.UpdatedAt,
+		page,
+	)
+
+	var eventType events.Type
+	switch payload.Action {
+	case "created":
+		eventType = events.Created
+	case "edited":
+		eventType = events.Edited
+		previous := utils.NewComment(payload.Comment.NodeID, payload.Changes.Body.From, "", "", "", page)
+		if comment.Resolved && !previous.Resolved {
+			eventType = events.Resolved
+		}
+	case "deleted":
+		eventType = events.Deleted
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if h.Events != nil {
+		h.Events.Publish(events.Event{
+			Type:    eventType,
+			Org:     payload.Repository.Owner.Login,
+			Repo:    payload.Repository.Name,
+			Page:    page,
+			Actor:   payload.Sender.Login,
+			Comment: comment,
+		})
+	}
+	slog.InfoContext(r.Context(), "ingested discussion_comment", "action", payload.Action, "page", page)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validSignature(secret, header string, body []byte) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Client returns an HTTP client for GitHub calls made while serving the
+// request in ctx. Each call carries the request ID and is logged at debug
+// level with it.
+func Client(ctx context.Context) *http.Client {
+	return &http.Client{Transport: &transport{ctx: ctx}}
+}
+
+type transport struct {
+	ctx context.Context
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestID(t.ctx); id != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Host+req.URL.Path),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	if err != nil {
+		slog.LogAttrs(t.ctx, slog.LevelWarn, "github call failed", append(attrs, slog.Any("err", err))...)
+		return nil, err
+	}
+	slog.LogAttrs(t.ctx, slog.LevelDebug, "github call", append(attrs, slog.Int("status", resp.StatusCode))...)
+	return resp, nil
+}
@@ -0,0 +1,107 @@
+// Package logging sets up structured JSON logs. Records made with a request's
+// context carry its request ID, and anything that looks like a secret is
+// redacted before it is written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are attribute names whose values are never logged.
+var secretKeys = []string{"token", "secret", "password", "cookie", "authorization", "credential", "jwt"}
+
+// secretPatterns match secrets inside free text such as error messages.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{16,}`),
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{16,}`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	regexp.MustCompile(`(?i)((?:bearer|token)\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`(?i)((?:github_token|session|code|state|client_secret|access_token)=)[^&\s;"]+`),
+}
+
+// Setup makes a JSON logger writing to w the default for both slog and the
+// log package.
+func Setup(w io.Writer, level slog.Level) *slog.Logger {
+	logger := New(w, level)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return logger
+}
+
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(contextHandler{h})
+}
+
+// ParseLevel reads debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if src, ok := a.Value.Any().(*slog.Source); ok {
+		return slog.String(a.Key, filepath.Base(src.File)+":"+strconv.Itoa(src.Line))
+	}
+
+	key := strings.ToLower(a.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, Scrub(v))
+	case error:
+		return slog.String(a.Key, Scrub(v.Error()))
+	}
+	return a
+}
+
+// Scrub replaces anything in s that looks like a token or session cookie.
+func Scrub(s string) string {
+	for _, p := range secretPatterns {
+		if p.NumSubexp() > 0 {
+			s = p.ReplaceAllString(s, "${1}"+redacted)
+		} else {
+			s = p.ReplaceAllString(s, redacted)
+		}
+	}
+	return s
+}
+
+// contextHandler adds the request ID from the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,120 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"log/slog"
+	"regexp"
+	"sync"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const defaultCacheSize = 2048
+
+var defaultRenderer = NewRenderer(defaultCacheSize)
+
+// Render converts a comment body to sanitized HTML using the shared renderer.
+// The result is cached under key and revision, so callers should pass the
+// comment ID and something that changes whenever the body does.
+func Render(key, revision, source string) string {
+	return defaultRenderer.Render(key, revision, source)
+}
+
+type Renderer struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+
+	mu       sync.Mutex
+	size     int
+	entries  map[string]*list.Element
+	eviction *list.List
+}
+
+type cacheEntry struct {
+	key  string
+	html string
+}
+
+func NewRenderer(cacheSize int) *Renderer {
+	return &Renderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(
+				extension.GFM,
+				&mentionExtension{},
+			),
+		),
+		policy:   newPolicy(),
+		size:     cacheSize,
+		entries:  make(map[string]*list.Element),
+		eviction: list.New(),
+	}
+}
+
+func (r *Renderer) Render(key, revision, source string) string {
+	cacheKey := key + "@" + revision
+
+	r.mu.Lock()
+	el, ok := r.entries[cacheKey]
+	metrics.CacheLookup("markdown", ok)
+	if ok {
+		r.eviction.MoveToFront(el)
+		html := el.Value.(*cacheEntry).html
+		r.mu.Unlock()
+		return html
+	}
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := r.md.Convert([]byte(source), &buf); err != nil {
+		slog.Error("markdown: rendering failed", "key", key, "err", err)
+		return r.policy.Sanitize(source)
+	}
+	html := r.policy.SanitizeBytes(buf.Bytes())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[cacheKey]; !ok {
+		r.entries[cacheKey] = r.eviction.PushFront(&cacheEntry{key: cacheKey, html: string(html)})
+		for r.eviction.Len() > r.size {
+			oldest := r.eviction.Back()
+			r.eviction.Remove(oldest)
+			delete(r.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+
+	return string(html)
+}
+
+// newPolicy only lets through the elements goldmark produces for GFM.
+// Raw HTML in comments is already dropped by goldmark; the sanitizer is the
+// second line of defence since anonymous mode serves comments to anyone.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "blockquote", "pre", "code",
+		"strong", "em", "del",
+		"ul", "ol", "li",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^mention$`)).OnElements("a")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
@@ -0,0 +1,103 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "javascript link",
+			source:  "[click](javascript:alert(1))",
+			want:    []string{"click"},
+			notWant: []string{"javascript:", "href"},
+		},
+		{
+			name:    "javascript autolink",
+			source:  "<javascript:alert(1)>",
+			notWant: []string{"href"},
+		},
+		{
+			name:    "raw html",
+			source:  "hi <script>alert(1)</script> <img src=x onerror=alert(1)>",
+			want:    []string{"hi"},
+			notWant: []string{"<script", "<img", "onerror"},
+		},
+		{
+			name:   "https link",
+			source: "[docs](https://example.com/a)",
+			want:   []string{`href="https://example.com/a"`, `rel="nofollow noreferrer noopener"`, `target="_blank"`},
+		},
+		{
+			name:   "mention",
+			source: "thanks @octocat",
+			want:   []string{`<a href="https://github.com/octocat" class="mention"`, "@octocat</a>"},
+		},
+		{
+			name:   "code block class",
+			source: "```go\nx := 1\n```",
+			want:   []string{`<code class="language-go">`},
+		},
+	}
+
+	r := NewRenderer(8)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := r.Render(tt.name, "1", tt.source)
+			for _, s := range tt.want {
+				if !strings.Contains(html, s) {
+					t.Errorf("Render(%q) = %q, missing %q", tt.source, html, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(html, s) {
+					t.Errorf("Render(%q) = %q, should not contain %q", tt.source, html, s)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderCache(t *testing.T) {
+	r := NewRenderer(1)
+	if got := r.Render("a", "1", "one"); !strings.Contains(got, "one") {
+		t.Fatalf("Render = %q", got)
+	}
+	if got := r.Render("a", "1", "changed"); !strings.Contains(got, "one") {
+		t.Errorf("same revision should be cached, got %q", got)
+	}
+	if got := r.Render("a", "2", "changed"); !strings.Contains(got, "changed") {
+		t.Errorf("new revision should render again, got %q", got)
+	}
+	if len(r.entries) != 1 {
+		t.Errorf("cache holds %d entries, want 1", len(r.entries))
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"@octocat can you look?", []string{"octocat"}},
+		{"@a-b and @A-B and @c", []string{"a-b", "c"}},
+		{"mail me at me@example.com", []string{}},
+		{"see `@code` and\n\n```\n@block\n```", []string{}},
+		{"@-bad @ok", []string{"ok"}},
+		{"[x](javascript:alert(1)) @after", []string{"after"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := Mentions(tt.source); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Mentions(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
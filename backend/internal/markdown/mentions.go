@@ -0,0 +1,84 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MentionPattern matches a GitHub login following an '@'.
+var MentionPattern = regexp.MustCompile(`^@([A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38})`)
+
+type mentionExtension struct{}
+
+func (e *mentionExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&mentionParser{}, 500),
+	))
+}
+
+type mentionParser struct{}
+
+func (p *mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (p *mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// Skip the '@' in email addresses and the like.
+	if before := block.PrecendingCharacter(); unicode.IsLetter(before) || unicode.IsDigit(before) || before == '_' || before == '/' {
+		return nil
+	}
+
+	line, segment := block.PeekLine()
+	match := MentionPattern.FindSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	block.Advance(len(match[0]))
+
+	link := ast.NewLink()
+	link.Destination = append([]byte("https://github.com/"), match[1]...)
+	link.SetAttributeString("class", []byte("mention"))
+	link.AppendChild(link, ast.NewTextSegment(segment.WithStop(segment.Start+len(match[0]))))
+	return link
+}
+
+// Mentions returns the distinct logins mentioned in source, ignoring anything
+// inside code spans and blocks.
+func Mentions(source string) []string {
+	return defaultRenderer.Mentions(source)
+}
+
+func (r *Renderer) Mentions(source string) []string {
+	src := []byte(source)
+	doc := r.md.Parser().Parse(text.NewReader(src))
+
+	seen := map[string]bool{}
+	logins := []string{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		link, ok := n.(*ast.Link)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		if class, ok := link.AttributeString("class"); !ok || string(class.([]byte)) != "mention" {
+			return ast.WalkContinue, nil
+		}
+		login := strings.TrimPrefix(string(link.Destination), "https://github.com/")
+		if key := strings.ToLower(login); !seen[key] {
+			seen[key] = true
+			logins = append(logins, login)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	return logins
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubCall records a finished GitHub API call. result is "ok" or the kind
+// of error, see ErrorKind.
+func GitHubCall(operation string, start time.Time, result string) {
+	githubRequests.WithLabelValues(operation, result).Inc()
+	githubDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ErrorKind sorts the outcome of a GitHub call into a few kinds, or "ok".
+// resp may be nil when err is set. It also notes the rate limit GitHub
+// reported.
+func ErrorKind(resp *http.Response, err error) string {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	recordRateLimit(resp.Header)
+
+	switch code := resp.StatusCode; {
+	case code < 300:
+		return "ok"
+	case code == http.StatusTooManyRequests,
+		code == http.StatusForbidden && (resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""):
+		return "rate_limited"
+	case code == http.StatusUnauthorized:
+		return "unauthorized"
+	case code == http.StatusForbidden:
+		return "forbidden"
+	case code == http.StatusNotFound:
+		return "not_found"
+	case code >= 500:
+		return "server_error"
+	default:
+		return "client_error"
+	}
+}
+
+func recordRateLimit(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resource := h.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	githubRateLimit.WithLabelValues(resource).Set(float64(remaining))
+}
+
+// Do sends a REST request to GitHub and records it under operation.
+func Do(client *http.Client, operation string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	GitHubCall(operation, start, ErrorKind(resp, err))
+	return resp, err
+}
+
+// GraphQLErrorKind looks for errors in a GraphQL response GitHub sent with a
+// 200, returning "ok" when there are none.
+func GraphQLErrorKind(body []byte) string {
+	var result struct {
+		Errors []struct {
+			Type string `json:"type"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "bad_response"
+	}
+	if len(result.Errors) == 0 {
+		return "ok"
+	}
+	for _, e := range result.Errors {
+		if e.Type == "RATE_LIMITED" {
+			return "rate_limited"
+		}
+	}
+	return "graphql"
+}
+
+// GraphQLOperation names a GraphQL document after its first top-level field,
+// such as search or createDiscussion. Fields that only wrap other lookups,
+// node and repository, say too little, so the operation name is used for
+// those instead.
+func GraphQLOperation(query string) string {
+	header, selection, ok := strings.Cut(query, "{")
+	if !ok {
+		return "unknown"
+	}
+	field := firstName(selection)
+	if rest := strings.TrimLeft(selection[strings.Index(selection, field)+len(field):], " \t\r\n"); strings.HasPrefix(rest, ":") {
+		// An alias; the field comes after it.
+		field = firstName(rest[1:])
+	}
+
+	if field == "node" || field == "repository" {
+		header = strings.TrimSpace(header)
+		if name := firstName(strings.TrimPrefix(header, firstName(header))); name != "" {
+			return strings.ToLower(name[:1]) + name[1:]
+		}
+	}
+	if field == "" {
+		return "unknown"
+	}
+	return field
+}
+
+// firstName reads a GraphQL name, which is ASCII letters, digits and
+// underscores, from the start of s.
+func firstName(s string) string {
+	s = strings.TrimLeft(s, " \t\r\n")
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	})
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
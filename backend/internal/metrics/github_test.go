@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+var operations = []struct{ query, want string }{
+	{`mutation AddComment($body: String!) { addDiscussionComment(input: {body: $body}) { comment { id } } }`, "addDiscussionComment"},
+	{"\nquery {\n  search(query: $q, type: DISCUSSION, first: 20) { nodes { id } }\n}", "search"},
+	{`{ viewer { login } }`, "viewer"},
+	// node and repository are named after the operation instead.
+	{`query LocateComment($id: ID!) { node(id: $id) { ... on DiscussionComment { id } } }`, "locateComment"},
+	{"query GetRepositoryID($owner: String!, $name: String!) {\n\trepository(owner: $owner, name: $name) { id }\n}", "getRepositoryID"},
+	{`query { repository(owner: "o", name: "r") { id } }`, "repository"},
+	// Aliases name the result, not the field.
+	{`query { first: search(query: "a") { issueCount } }`, "search"},
+	{`query Other { hit : node(id: "x") { id } }`, "other"},
+	{`query ListComments($id: ID!) { node(id: $id) { ...CommentFields } }
+fragment CommentFields on DiscussionComment { id body }`, "listComments"},
+	{``, "unknown"},
+	{`not graphql`, "unknown"},
+	{`query Broken {`, "unknown"},
+}
+
+func TestGraphQLOperation(t *testing.T) {
+	for _, op := range operations {
+		if got := GraphQLOperation(op.query); got != op.want {
+			t.Errorf("GraphQLOperation(%q) = %q, want %q", op.query, got, op.want)
+		}
+	}
+}
+
+// Operation names become metric labels, so whatever comes in must give a
+// short, non-empty, valid string back.
+func FuzzGraphQLOperation(f *testing.F) {
+	for _, op := range operations {
+		f.Add(op.query)
+	}
+	f.Add("{:}")
+	f.Add("query Q { a : }")
+	f.Add("query Ñame { node(id: 1) { id } }")
+	f.Fuzz(func(t *testing.T, query string) {
+		name := GraphQLOperation(query)
+		if name == "" || len(name) > len(query)+len("unknown") || !utf8.ValidString(name) && utf8.ValidString(query) {
+			t.Errorf("GraphQLOperation(%q) = %q", query, name)
+		}
+	})
+}
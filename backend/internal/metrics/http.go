@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+)
+
+// Middleware counts requests and their latency by the ServeMux pattern they
+// matched, so paths with IDs in them don't each get their own series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &logging.StatusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		// Streams and websockets last as long as the client stays, which
+		// says nothing about latency.
+		stream := rec.Status() == http.StatusSwitchingProtocols || rec.Header().Get("Content-Type") == "text/event-stream"
+		observeRequest(route, r.Method, rec.Status(), time.Since(start), stream)
+	})
+}
@@ -0,0 +1,209 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+)
+
+// ChatRoute sends events for one org, or one repo within it, to a Slack or
+// Mattermost incoming webhook. SiteURL is the root of the Docusaurus site and
+// is used to link back to the commented page.
+type ChatRoute struct {
+	Org     string        `json:"org"`
+	Repo    string        `json:"repo,omitempty"`
+	URL     string        `json:"url"`
+	SiteURL string        `json:"site_url"`
+	Events  []events.Type `json:"events,omitempty"`
+}
+
+func (r ChatRoute) matches(e events.Event) bool {
+	if r.Org != e.Org || (r.Repo != "" && r.Repo != e.Repo) {
+		return false
+	}
+	if len(r.Events) == 0 {
+		return e.Type == events.Created || e.Type == events.Resolved
+	}
+	return slices.Contains(r.Events, e.Type)
+}
+
+// LoadChatRoutes reads routes from the JSON file at path. No file means no
+// chat notifications.
+func LoadChatRoutes(path string) ([]ChatRoute, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("notify: reading chat routes: %w", err)
+	}
+
+	var routes []ChatRoute
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("notify: parsing chat routes: %w", err)
+	}
+	for i, route := range routes {
+		if route.Org == "" || route.URL == "" {
+			return nil, fmt.Errorf("notify: chat route %d needs an org and a url", i)
+		}
+	}
+	return routes, nil
+}
+
+// ChatNotifier posts comment events to Slack/Mattermost incoming webhooks.
+// Both accept the same text + attachments message shape.
+type ChatNotifier struct {
+	Routes []ChatRoute
+	Client *http.Client
+}
+
+type chatMessage struct {
+	Text        string           `json:"text"`
+	Attachments []chatAttachment `json:"attachments,omitempty"`
+}
+
+type chatAttachment struct {
+	Fallback   string `json:"fallback"`
+	Color      string `json:"color,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	AuthorLink string `json:"author_link,omitempty"`
+	Title      string `json:"title,omitempty"`
+	TitleLink  string `json:"title_link,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Footer     string `json:"footer,omitempty"`
+	Timestamp  int64  `json:"ts,omitempty"`
+}
+
+func (c *ChatNotifier) Run(ctx context.Context, broker *events.Broker) {
+	if len(c.Routes) == 0 {
+		return
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	broker.Listen(ctx, func(e events.Event) {
+		for _, route := range c.Routes {
+			if !route.matches(e) {
+				continue
+			}
+			if err := c.post(ctx, route.URL, formatChatMessage(route, e)); err != nil {
+				slog.Error("notify: posting to chat failed", "event", e.Type, "comment", e.Comment.ID, "err", err)
+			}
+		}
+	})
+}
+
+func (c *ChatNotifier) post(ctx context.Context, hookURL string, msg chatMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", hookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("chat webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func formatChatMessage(route ChatRoute, e events.Event) chatMessage {
+	link := pageLink(route.SiteURL, e.Page, threadID(e))
+	author := e.Comment.User
+
+	var verb, color string
+	switch e.Type {
+	case events.Created:
+		verb, color = "New feedback", "#2eb886"
+		if e.Comment.ReplyTo != "" {
+			verb = "New reply"
+		}
+	case events.Resolved:
+		verb, color = "Feedback resolved", "#439fe0"
+	case events.Edited:
+		verb, color = "Feedback edited", "#daa038"
+	case events.Deleted:
+		verb, color = "Feedback deleted", "#a30200"
+	}
+
+	actor := e.Actor
+	if actor == "" {
+		actor = author
+	}
+
+	title := escapeChat(e.Page)
+	headline := fmt.Sprintf("%s on %s", verb, title)
+	if link != "" {
+		headline = fmt.Sprintf("%s on <%s|%s>", verb, link, title)
+	}
+	if actor != "" {
+		headline += " by " + escapeChat(actor)
+	}
+
+	var text strings.Builder
+	if e.Comment.Text != "" {
+		for _, line := range strings.Split(e.Comment.Text, "\n") {
+			text.WriteString("> " + escapeChat(line) + "\n")
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString(escapeChat(e.Comment.Comment))
+
+	attachment := chatAttachment{
+		Fallback:  fmt.Sprintf("%s on %s: %s", verb, e.Page, e.Comment.Comment),
+		Color:     color,
+		Title:     e.Page,
+		TitleLink: link,
+		Text:      text.String(),
+		Footer:    e.Org + "/" + e.Repo,
+		Timestamp: e.Time.Unix(),
+	}
+	if author != "" {
+		attachment.AuthorName = author
+		attachment.AuthorLink = "https://github.com/" + url.PathEscape(author)
+	}
+
+	return chatMessage{Text: headline, Attachments: []chatAttachment{attachment}}
+}
+
+// pageLink points at the thread's highlight on the page, which the plugin
+// gives the ID comment-<id>; replies have no highlight of their own. Pages
+// are stored as the pathname the plugin saw, so they can be appended to the
+// site root as is.
+func pageLink(siteURL, page, commentID string) string {
+	if siteURL == "" {
+		return ""
+	}
+	link := strings.TrimSuffix(siteURL, "/") + "/" + strings.TrimPrefix(page, "/")
+	if commentID != "" {
+		link += "#comment-" + url.QueryEscape(commentID)
+	}
+	return link
+}
+
+// escapeChat escapes the three characters Slack and Mattermost treat as
+// control sequences in message text.
+func escapeChat(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,285 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const (
+	digestInterval = 24 * time.Hour
+	digestCheck    = time.Hour
+)
+
+// Dispatcher turns comment events into activity records and emails. Users
+// who opted in to the daily digest only hear about activity through it.
+type Dispatcher struct {
+	Store  *store.Store
+	Mailer *Mailer
+	// Sites decides who may still read a repo's comments when mail goes
+	// out. Org membership on team-only repos and public emails are looked
+	// up with Client.
+	Sites  *sites.Registry
+	Client *http.Client
+	// GitHubToken looks up memberships and public emails.
+	GitHubToken string
+}
+
+type message struct {
+	Notification
+	Recipient string
+}
+
+type digestPage struct {
+	Org      string
+	Repo     string
+	Page     string
+	Activity []store.Activity
+}
+
+func (d *Dispatcher) Run(ctx context.Context, broker *events.Broker) {
+	if d.Mailer != nil {
+		go d.runDigests(ctx)
+	}
+	broker.Listen(ctx, d.handle)
+}
+
+func (d *Dispatcher) handle(e events.Event) {
+	if e.Type != events.Created && e.Type != events.Resolved {
+		return
+	}
+
+	thread := threadID(e)
+
+	if e.Type == events.Created && e.Comment.User != "" {
+		err := d.Store.SubscribeThread(store.ThreadSubscription{
+			Login:    e.Comment.User,
+			ThreadID: thread,
+			Org:      e.Org,
+			Repo:     e.Repo,
+			Page:     e.Page,
+		})
+		if err != nil {
+			slog.Error("notify: subscribing to thread failed", "login", e.Comment.User, "thread", thread, "err", err)
+		}
+	}
+
+	err := d.Store.RecordActivity(store.Activity{
+		Type:      string(e.Type),
+		Org:       e.Org,
+		Repo:      e.Repo,
+		Page:      e.Page,
+		CommentID: e.Comment.ID,
+		ThreadID:  thread,
+		Actor:     e.Actor,
+		Text:      e.Comment.Text,
+		Comment:   e.Comment.Comment,
+		CreatedAt: e.Time,
+	})
+	if err != nil {
+		slog.Error("notify: recording activity failed", "comment", e.Comment.ID, "err", err)
+	}
+
+	if d.Mailer == nil {
+		return
+	}
+
+	recipients, err := d.recipients(e)
+	if err != nil {
+		slog.Error("notify: finding recipients failed", "comment", e.Comment.ID, "err", err)
+		return
+	}
+
+	for login, tmpl := range recipients {
+		prefs, err := d.Store.GetUser(login)
+		if err != nil {
+			slog.Error("notify: loading preferences failed", "login", login, "err", err)
+			continue
+		}
+		if prefs.Digest {
+			continue
+		}
+		to := lookupEmail(d.client(), d.Store, d.GitHubToken, login)
+		if to == "" {
+			continue
+		}
+
+		msg := message{
+			Notification: Notification{
+				Actor:   e.Actor,
+				Org:     e.Org,
+				Repo:    e.Repo,
+				Page:    e.Page,
+				Comment: e.Comment,
+			},
+			Recipient: login,
+		}
+		if err := d.Mailer.Send(to, tmpl, msg); err != nil {
+			slog.Error("notify: mailing failed", "login", login, "err", err)
+		}
+	}
+}
+
+// recipients maps each login to the template they should receive. Thread
+// followers get the more specific template, and a muted thread wins over
+// any page or repo subscription.
+func (d *Dispatcher) recipients(e events.Event) (map[string]string, error) {
+	subscribers, err := d.Store.Subscribers(e.Org, e.Repo, e.Page)
+	if err != nil {
+		return nil, err
+	}
+	following, muted, err := d.Store.ThreadSubscribers(threadID(e))
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := map[string]string{}
+	switch e.Type {
+	case events.Created:
+		for _, login := range subscribers {
+			recipients[login] = "comment"
+		}
+		if e.Comment.ReplyTo != "" {
+			for _, login := range following {
+				recipients[login] = "reply"
+			}
+		}
+		if e.Comment.ReplyToUser != "" {
+			recipients[e.Comment.ReplyToUser] = "reply"
+		}
+	case events.Resolved:
+		for _, login := range append(subscribers, following...) {
+			recipients[login] = "resolved"
+		}
+		if e.Comment.User != "" {
+			recipients[e.Comment.User] = "resolved"
+		}
+	}
+
+	for login := range recipients {
+		if strings.EqualFold(login, e.Actor) || slices.ContainsFunc(muted, func(m string) bool { return strings.EqualFold(m, login) }) || !d.canRead(e.Org, e.Repo, login) {
+			delete(recipients, login)
+		}
+	}
+	return recipients, nil
+}
+
+// canRead checks login may still read org/repo. Memberships change after
+// people subscribe, so this runs for every mail rather than once.
+func (d *Dispatcher) canRead(org, repo, login string) bool {
+	ok, err := d.Sites.CanRead(org, repo, func() (bool, error) {
+		return utils.IsOrgMember(d.client(), d.GitHubToken, org, login)
+	})
+	if err != nil {
+		slog.Warn("notify: checking access failed", "login", login, "org", org, "repo", repo, "err", err)
+		return false
+	}
+	return ok
+}
+
+// client is used for GitHub lookups, which run outside any request.
+func (d *Dispatcher) client() *http.Client {
+	if d.Client == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return d.Client
+}
+
+// readable drops activity from repos login can no longer read.
+func (d *Dispatcher) readable(login string, activity []store.Activity) []store.Activity {
+	allowed := map[string]bool{}
+	return slices.DeleteFunc(activity, func(a store.Activity) bool {
+		key := a.Org + "/" + a.Repo
+		ok, checked := allowed[key]
+		if !checked {
+			ok = d.canRead(a.Org, a.Repo, login)
+			allowed[key] = ok
+		}
+		return !ok
+	})
+}
+
+// threadID is the top-level comment a comment belongs to.
+func threadID(e events.Event) string {
+	if e.Comment.ReplyTo != "" {
+		return e.Comment.ReplyTo
+	}
+	return e.Comment.ID
+}
+
+func (d *Dispatcher) runDigests(ctx context.Context) {
+	ticker := time.NewTicker(digestCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.sendDigests(now)
+		}
+	}
+}
+
+func (d *Dispatcher) sendDigests(now time.Time) {
+	users, err := d.Store.DigestUsers()
+	if err != nil {
+		slog.Error("notify: listing digest users failed", "err", err)
+		return
+	}
+
+	for _, u := range users {
+		since := now.Add(-digestInterval)
+		if u.LastDigestAt != nil {
+			if now.Sub(*u.LastDigestAt) < digestInterval {
+				continue
+			}
+			since = *u.LastDigestAt
+		}
+
+		activity, err := d.Store.ActivityForSubscriber(u.Login, since)
+		if err != nil {
+			slog.Error("notify: loading digest failed", "login", u.Login, "err", err)
+			continue
+		}
+		activity = d.readable(u.Login, activity)
+
+		if len(activity) > 0 {
+			data := struct {
+				Recipient string
+				Pages     []digestPage
+			}{
+				Recipient: u.Login,
+				Pages:     groupByPage(activity),
+			}
+			if err := d.Mailer.Send(u.Email, "digest", data); err != nil {
+				slog.Error("notify: mailing digest failed", "login", u.Login, "err", err)
+				continue
+			}
+		}
+
+		if err := d.Store.MarkDigestSent(u.Login, now); err != nil {
+			slog.Error("notify: marking digest sent failed", "login", u.Login, "err", err)
+		}
+	}
+}
+
+// groupByPage relies on activity already being ordered by page.
+func groupByPage(activity []store.Activity) []digestPage {
+	var pages []digestPage
+	for _, a := range activity {
+		if n := len(pages); n == 0 || pages[n-1].Org != a.Org || pages[n-1].Repo != a.Repo || pages[n-1].Page != a.Page {
+			pages = append(pages, digestPage{Org: a.Org, Repo: a.Repo, Page: a.Page})
+		}
+		pages[len(pages)-1].Activity = append(pages[len(pages)-1].Activity, a)
+	}
+	return pages
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+// EmailNotifier mails each mentioned user. Recipients without a known
+// address are skipped.
+type EmailNotifier struct {
+	Mailer *Mailer
+	Store  *store.Store
+	// GitHubToken reads public emails for users who never signed in.
+	GitHubToken string
+	Client      *http.Client
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var errs []error
+	for _, login := range n.Recipients {
+		to := lookupEmail(client, e.Store, e.GitHubToken, login)
+		if to == "" {
+			slog.InfoContext(ctx, "notify: no email, skipping", "login", login)
+			continue
+		}
+		if err := e.Mailer.Send(to, string(n.Kind), n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,236 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+)
+
+type Handler struct {
+	Store    *store.Store
+	Sessions *auth.Sessions
+	Sites    *sites.Registry
+}
+
+type UpdatePreferencesRequest struct {
+	Digest bool `json:"digest"`
+}
+
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := h.Store.GetUser(viewer.Login)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load preferences", "err", err)
+		http.Error(w, "failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdatePreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.SetDigest(viewer.Login, req.Digest); err != nil {
+		slog.ErrorContext(r.Context(), "failed to save preferences", "err", err)
+		http.Error(w, "failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetPreferences(w, r)
+}
+
+type SubscriptionRequest struct {
+	Org  string `json:"org"`
+	Repo string `json:"repo"`
+	Page string `json:"page,omitempty"`
+}
+
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subs, err := h.Store.Subscriptions(viewer.Login)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list subscriptions", "err", err)
+		http.Error(w, "failed to load subscriptions", http.StatusInternalServerError)
+		return
+	}
+	threads, err := h.Store.ThreadSubscriptions(viewer.Login)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list subscriptions", "err", err)
+		http.Error(w, "failed to load subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"subscriptions": subs,
+		"threads":       threads,
+	})
+}
+
+// Subscribe watches a page, or a whole repo when page is omitted.
+func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Org == "" || req.Repo == "" {
+		http.Error(w, "org and repo are required", http.StatusBadRequest)
+		return
+	}
+	allowed, _ := h.Sites.CanRead(req.Org, req.Repo, func() (bool, error) {
+		return viewer.IsInOrg([]string{req.Org}), nil
+	})
+	if !allowed {
+		http.Error(w, "you can't read comments in this repo", http.StatusForbidden)
+		return
+	}
+
+	err = h.Store.Subscribe(store.Subscription{Login: viewer.Login, Org: req.Org, Repo: req.Repo, Page: req.Page})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to subscribe", "err", err)
+		http.Error(w, "failed to subscribe", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unsubscribe takes org, repo and optionally page as query parameters.
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("org") == "" || q.Get("repo") == "" {
+		http.Error(w, "Missing ?org= and ?repo= query parameters", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.Unsubscribe(store.Subscription{Login: viewer.Login, Org: q.Get("org"), Repo: q.Get("repo"), Page: q.Get("page")})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unsubscribe", "err", err)
+		http.Error(w, "failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type MuteThreadRequest struct {
+	ThreadID string `json:"threadId"`
+}
+
+// MuteThread mutes any thread the viewer can read. Its page is looked up
+// rather than taken from the request.
+func (h *Handler) MuteThread(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MuteThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ThreadID == "" {
+		http.Error(w, "threadId is required", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.Store.ThreadSubscription(viewer.Login, req.ThreadID)
+	if errors.Is(err, store.ErrNotFound) {
+		sub = store.ThreadSubscription{Login: viewer.Login, ThreadID: req.ThreadID}
+		sub.Org, sub.Repo, sub.Page, err = h.Store.ThreadLocation(req.ThreadID)
+		if err == nil && !h.canMute(viewer, sub.Org, sub.Repo) {
+			err = store.ErrNotFound
+		}
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "thread not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = h.Store.MuteThread(sub)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to mute thread", "err", err)
+		http.Error(w, "failed to mute thread", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// canMute decides whether the viewer may add a thread they don't follow.
+// Once unmuted the thread shows in their inbox, so it has to be one they
+// could read anyway: in one of their orgs or on a site that isn't
+// team-only.
+func (h *Handler) canMute(viewer *user.User, org, repo string) bool {
+	if viewer.IsInOrg([]string{org}) {
+		return true
+	}
+	level, ok := h.Sites.LevelFor(org, repo)
+	return ok && level != "team"
+}
+
+// UnmuteThread only unmutes threads the viewer already has.
+func (h *Handler) UnmuteThread(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.Store.UnmuteThread(viewer.Login, r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "thread not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unmute thread", "err", err)
+		http.Error(w, "failed to unmute thread", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
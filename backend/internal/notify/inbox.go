@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+const (
+	defaultInboxLimit = 50
+	maxInboxLimit     = 200
+)
+
+type InboxResponse struct {
+	Unread int              `json:"unread"`
+	Items  []store.Activity `json:"items"`
+}
+
+// Inbox lists comments and replies the viewer hasn't read yet, newest first.
+func (h *Handler) Inbox(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := defaultInboxLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxInboxLimit)
+	}
+
+	items, unread, err := h.Store.Inbox(store.InboxQuery{
+		Login: viewer.Login,
+		Orgs:  viewer.OrgLogins,
+		Limit: limit,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load inbox", "err", err)
+		http.Error(w, "failed to load inbox", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(InboxResponse{Unread: unread, Items: items})
+}
+
+type MarkReadRequest struct {
+	Org  string `json:"org"`
+	Repo string `json:"repo"`
+	Page string `json:"page"`
+}
+
+func (h *Handler) MarkPageRead(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Org == "" || req.Repo == "" || req.Page == "" {
+		http.Error(w, "org, repo and page are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.MarkPageRead(viewer.Login, req.Org, req.Repo, req.Page, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "failed to mark page read", "err", err)
+		http.Error(w, "failed to mark page read", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Store.MarkAllRead(viewer.Login, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "failed to mark all read", "err", err)
+		http.Error(w, "failed to mark inbox read", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
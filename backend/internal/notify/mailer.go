@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Mailer sends templated plain-text email through an SMTP server. Any
+// template can be replaced by a file of the same name in TemplateDir.
+//
+// For local development point Addr at a mail catcher such as Mailpit
+// (localhost:1025) and leave Username empty.
+type Mailer struct {
+	Addr        string
+	From        string
+	Username    string
+	Password    string
+	TemplateDir string
+
+	mu        sync.Mutex
+	templates map[string]*template.Template
+}
+
+// NewMailer returns nil when no SMTP address is set, which disables email.
+func NewMailer(cfg config.Notify) *Mailer {
+	if cfg.SMTP.Addr == "" {
+		return nil
+	}
+	return &Mailer{
+		Addr:        cfg.SMTP.Addr,
+		From:        cfg.SMTP.From,
+		Username:    cfg.SMTP.Username,
+		Password:    cfg.SMTP.Password,
+		TemplateDir: cfg.TemplateDir,
+	}
+}
+
+// Send renders the "subject" and "body" blocks of the named template with
+// data and mails the result to a single recipient.
+func (m *Mailer) Send(to, name string, data any) error {
+	tmpl, err := m.template(name)
+	if err != nil {
+		return err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return fmt.Errorf("notify: rendering %s subject: %w", name, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return fmt.Errorf("notify: rendering %s body: %w", name, err)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(body.String(), "\n", "\r\n"),
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+func (m *Mailer) template(name string) (*template.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tmpl, ok := m.templates[name]; ok {
+		return tmpl, nil
+	}
+
+	file := name + ".tmpl"
+	var tmpl *template.Template
+	var err error
+	if m.TemplateDir != "" {
+		if _, statErr := os.Stat(filepath.Join(m.TemplateDir, file)); statErr == nil {
+			tmpl, err = template.ParseFiles(filepath.Join(m.TemplateDir, file))
+		}
+	}
+	if tmpl == nil && err == nil {
+		tmpl, err = template.ParseFS(defaultTemplates, "templates/"+file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("notify: loading template %s: %w", name, err)
+	}
+
+	if m.templates == nil {
+		m.templates = make(map[string]*template.Template)
+	}
+	m.templates[name] = tmpl
+	return tmpl, nil
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+type Kind string
+
+const (
+	KindMention Kind = "mention"
+)
+
+type Notification struct {
+	Kind       Kind          `json:"kind"`
+	Recipients []string      `json:"recipients"`
+	Actor      string        `json:"actor"`
+	Org        string        `json:"org"`
+	Repo       string        `json:"repo"`
+	Page       string        `json:"page"`
+	Comment    utils.Comment `json:"comment"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// New picks the mention notifier named by cfg.Notifier. It defaults to
+// relying on GitHub's own mention notifications.
+func New(cfg config.Notify, mailer *Mailer, st *store.Store, githubToken string) Notifier {
+	switch cfg.Notifier {
+	case "webhook":
+		return &WebhookNotifier{URL: cfg.WebhookURL}
+	case "email":
+		if mailer == nil {
+			slog.Warn("notify: NOTIFIER=email needs SMTP_ADDR, falling back to github")
+			return GitHubNotifier{}
+		}
+		return &EmailNotifier{Mailer: mailer, Store: st, GitHubToken: githubToken}
+	case "", "github":
+		return GitHubNotifier{}
+	default:
+		slog.Warn("notify: unknown NOTIFIER, falling back to github", "notifier", cfg.Notifier)
+		return GitHubNotifier{}
+	}
+}
+
+// GitHubNotifier does nothing itself: the @login left in the Discussion body
+// is enough for GitHub to notify the mentioned user.
+type GitHubNotifier struct{}
+
+func (GitHubNotifier) Notify(ctx context.Context, n Notification) error {
+	return nil
+}
+
+// lookupEmail prefers the address a user signed in with and falls back to
+// the public email on their GitHub profile.
+func lookupEmail(client *http.Client, st *store.Store, githubToken, login string) string {
+	if st != nil {
+		if prefs, err := st.GetUser(login); err == nil && prefs.Email != "" {
+			return prefs.Email
+		}
+	}
+
+	email, err := utils.GetPublicEmail(client, githubToken, login)
+	if err != nil {
+		slog.Warn("notify: looking up email failed", "login", login, "err", err)
+		return ""
+	}
+	return email
+}
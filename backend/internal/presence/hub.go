@@ -0,0 +1,237 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+)
+
+var ErrRoomFull = errors.New("room is full")
+
+// Selection is what a reader has highlighted, in the same form comments
+// anchor to text so clients can reuse their re-anchoring logic.
+type Selection struct {
+	ContextBefore string `json:"contextBefore"`
+	Text          string `json:"text"`
+	ContextAfter  string `json:"contextAfter"`
+}
+
+type Member struct {
+	Login     string     `json:"user"`
+	AvatarUrl string     `json:"avatar_url"`
+	Selection *Selection `json:"selection,omitempty"`
+}
+
+type Message struct {
+	Type      string     `json:"type"`
+	Member    *Member    `json:"member,omitempty"`
+	Members   []Member   `json:"members,omitempty"`
+	Selection *Selection `json:"selection,omitempty"`
+}
+
+type RoomKey struct {
+	Org  string
+	Repo string
+	Page string
+}
+
+// Hub tracks one room per page. Rooms are created on first join and removed
+// once the last member leaves.
+type Hub struct {
+	mu          sync.Mutex
+	rooms       map[RoomKey]*room
+	maxRoomSize int
+	idleTimeout time.Duration
+}
+
+type room struct {
+	clients map[*client]struct{}
+}
+
+type client struct {
+	user       *user.User
+	selection  *Selection
+	send       chan []byte
+	lastActive time.Time
+	closed     bool
+}
+
+func NewHub(maxRoomSize int, idleTimeout time.Duration) *Hub {
+	return &Hub{
+		rooms:       make(map[RoomKey]*room),
+		maxRoomSize: maxRoomSize,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Run disconnects members that have been idle for longer than the hub's
+// idle timeout. It returns when ctx is done.
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			for key, rm := range h.rooms {
+				for c := range rm.clients {
+					if now.Sub(c.lastActive) > h.idleTimeout {
+						slog.Info("presence: disconnecting idle member", "login", c.user.Login, "org", key.Org, "repo", key.Repo, "page", key.Page)
+						h.leaveLocked(key, c)
+					}
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// DisconnectAll closes every member's connection, for shutting down.
+func (h *Hub) DisconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, rm := range h.rooms {
+		for c := range rm.clients {
+			h.leaveLocked(key, c)
+		}
+	}
+}
+
+// full reports whether the room for key has no space for another member.
+func (h *Hub) full(key RoomKey) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rm, ok := h.rooms[key]
+	return ok && len(rm.clients) >= h.maxRoomSize
+}
+
+func (h *Hub) join(key RoomKey, u *user.User) (*client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rm, ok := h.rooms[key]
+	if !ok {
+		rm = &room{clients: make(map[*client]struct{})}
+		h.rooms[key] = rm
+	}
+	if len(rm.clients) >= h.maxRoomSize {
+		return nil, ErrRoomFull
+	}
+
+	c := &client{
+		user:       u,
+		send:       make(chan []byte, 16),
+		lastActive: time.Now(),
+	}
+
+	members := make([]Member, 0, len(rm.clients))
+	for other := range rm.clients {
+		members = append(members, other.member())
+	}
+	rm.clients[c] = struct{}{}
+
+	c.enqueue(Message{Type: "snapshot", Members: members})
+	h.broadcastLocked(rm, c, Message{Type: "join", Member: ptr(c.member())})
+
+	return c, nil
+}
+
+func (h *Hub) leave(key RoomKey, c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(key, c)
+}
+
+func (h *Hub) leaveLocked(key RoomKey, c *client) {
+	rm, ok := h.rooms[key]
+	if !ok {
+		return
+	}
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	delete(rm.clients, c)
+	c.close()
+
+	if len(rm.clients) == 0 {
+		delete(h.rooms, key)
+		return
+	}
+	h.broadcastLocked(rm, nil, Message{Type: "leave", Member: &Member{Login: c.user.Login, AvatarUrl: c.user.AvatarUrl}})
+}
+
+func (h *Hub) updateSelection(key RoomKey, c *client, selection *Selection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rm, ok := h.rooms[key]
+	if !ok {
+		return
+	}
+	if _, ok := rm.clients[c]; !ok {
+		return
+	}
+
+	c.selection = selection
+	c.lastActive = time.Now()
+	h.broadcastLocked(rm, c, Message{Type: "selection", Member: ptr(c.member())})
+}
+
+func (h *Hub) touch(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.lastActive = time.Now()
+}
+
+func (h *Hub) broadcastLocked(rm *room, from *client, msg Message) {
+	for c := range rm.clients {
+		if c != from {
+			c.enqueue(msg)
+		}
+	}
+}
+
+func (c *client) member() Member {
+	return Member{
+		Login:     c.user.Login,
+		AvatarUrl: c.user.AvatarUrl,
+		Selection: c.selection,
+	}
+}
+
+// enqueue must be called with the hub lock held. Slow readers miss updates
+// rather than blocking the room.
+func (c *client) enqueue(msg Message) {
+	if c.closed {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("presence: encoding message failed", "type", msg.Type, "err", err)
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+func (c *client) close() {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,161 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 8 << 10
+)
+
+type Handler struct {
+	Hub            *Hub
+	AllowedOrigins []string
+	Sessions       *auth.Sessions
+	Sites          *sites.Registry
+}
+
+func (h *Handler) Join(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	target, err := h.Sites.Resolve(r)
+	if err != nil {
+		sites.Error(w, err)
+		return
+	}
+
+	key := RoomKey{
+		Org:  r.PathValue("org"),
+		Repo: r.PathValue("repo"),
+		Page: r.PathValue("page"),
+	}
+
+	if target.Level == "team" && !viewer.IsInOrg([]string{key.Org}) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Checked again by join, but refusing here saves upgrading a connection
+	// only to close it.
+	if h.Hub.full(key) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, ErrRoomFull.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return slices.Contains(h.AllowedOrigins, origin) || h.Sites.AllowsOrigin(origin)
+		},
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "presence: upgrade failed", "err", err)
+		return
+	}
+
+	c, err := h.Hub.join(key, viewer)
+	if errors.Is(err, ErrRoomFull) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+
+	metrics.PresenceConnections.Inc()
+	defer metrics.PresenceConnections.Dec()
+
+	go writePump(conn, c, viewer.ExpiresAt)
+	readPump(conn, h.Hub, key, c)
+}
+
+func readPump(conn *websocket.Conn, hub *Hub, key RoomKey, c *client) {
+	defer func() {
+		hub.leave(key, c)
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		hub.touch(c)
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "selection":
+			hub.updateSelection(key, c, msg.Selection)
+		case "clear":
+			hub.updateSelection(key, c, nil)
+		case "ping":
+			hub.touch(c)
+		}
+	}
+}
+
+// writePump sends the room's messages and pings, and closes the connection
+// once the session it was opened with expires.
+func writePump(conn *websocket.Conn, c *client, expiresAt time.Time) {
+	ticker := time.NewTicker(pingPeriod)
+	var expired <-chan time.Time
+	if !expiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(expiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-expired:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired"), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
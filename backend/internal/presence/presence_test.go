@@ -0,0 +1,104 @@
+package presence
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/user"
+)
+
+const origin = "https://docs.example.com"
+
+func newServer(t *testing.T, hub *Hub) (*httptest.Server, *auth.Sessions) {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	registry, err := sites.NewRegistry(st, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := &auth.Sessions{JWTSecret: "secret", CookieKey: strings.Repeat("k", 32)}
+	h := &Handler{Hub: hub, AllowedOrigins: []string{origin}, Sessions: sessions, Sites: registry}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{org}/{repo}/{page}/presence", h.Join)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, sessions
+}
+
+func sessionHeader(t *testing.T, sessions *auth.Sessions, expires time.Time) http.Header {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":    1,
+		"login":      "octocat",
+		"email":      "",
+		"avatar_url": "",
+		"exp":        expires.Unix(),
+	}).SignedString([]byte(sessions.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return http.Header{"Cookie": {"session=" + signed}, "Origin": {origin}}
+}
+
+func TestJoinFullRoomBeforeUpgrade(t *testing.T) {
+	hub := NewHub(1, time.Minute)
+	srv, sessions := newServer(t, hub)
+	if _, err := hub.join(RoomKey{"acme", "docs", "intro"}, &user.User{Login: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/acme/docs/intro/presence"
+	_, resp, err := websocket.DefaultDialer.Dial(url, sessionHeader(t, sessions, time.Now().Add(time.Hour)))
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("Dial = %v, want a refused handshake", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("full room answered %d with Retry-After %q, want 429", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// Other pages have their own rooms.
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(url, "intro", "setup", 1), sessionHeader(t, sessions, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestSocketClosesWhenSessionExpires(t *testing.T) {
+	srv, sessions := newServer(t, NewHub(5, time.Minute))
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/acme/docs/intro/presence"
+	conn, _, err := websocket.DefaultDialer.Dial(url, sessionHeader(t, sessions, time.Now().Add(2*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Fatalf("ReadMessage = %v, want a policy violation close", err)
+		}
+		return
+	}
+}
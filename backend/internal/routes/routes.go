@@ -1,36 +1,153 @@
 package routes
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"time"
 
+	"github.com/NicholasRucinski/commentasaurus/internal/admin"
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
 	"github.com/NicholasRucinski/commentasaurus/internal/auth"
 	comments "github.com/NicholasRucinski/commentasaurus/internal/comment"
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/ingest"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/notify"
+	"github.com/NicholasRucinski/commentasaurus/internal/presence"
+	"github.com/NicholasRucinski/commentasaurus/internal/search"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/webhooks"
 	"github.com/rs/cors"
 )
 
-func RegisterRoutes() http.Handler {
-	commentHandler := &comments.Handler{}
+// RegisterRoutes builds the API. Background workers run until ctx is done.
+// disconnect ends comment streams and presence sockets, which would otherwise
+// hold up a graceful shutdown.
+func RegisterRoutes(ctx context.Context, st *store.Store, cfg *config.Config) (handler http.Handler, disconnect func(), err error) {
+	broker := events.NewBroker(1000)
+	mailer := notify.NewMailer(cfg.Notify)
+	sessions := &auth.Sessions{JWTSecret: cfg.JWTSecret, CookieKey: cfg.CookieKey, AdminUsers: cfg.AdminUsers}
+	githubToken := cfg.GitHub.Token
+
+	registry, err := sites.NewRegistry(st, cfg.Sites, githubToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading sites: %w", err)
+	}
+
+	dispatcher := &notify.Dispatcher{Store: st, Mailer: mailer, Sites: registry, GitHubToken: githubToken}
+	go dispatcher.Run(ctx, broker)
+
+	chatRoutes, err := notify.LoadChatRoutes(cfg.Notify.ChatRoutesFile)
+	if err != nil {
+		slog.Warn("chat notifications disabled", "err", err)
+	}
+	chatNotifier := &notify.ChatNotifier{Routes: chatRoutes}
+	go chatNotifier.Run(ctx, broker)
+
+	auditLog, err := audit.Open(cfg.Audit, st)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	go auditLog.Run(ctx)
+
+	commentHandler := &comments.Handler{
+		Audit:       auditLog,
+		Events:      broker,
+		Notifier:    notify.New(cfg.Notify, mailer, st, githubToken),
+		Sessions:    sessions,
+		Sites:       registry,
+		Store:       st,
+		GitHubToken: githubToken,
+	}
 	router := http.NewServeMux()
 
 	router.HandleFunc("POST /{org}/{repo}/{page}/comments", commentHandler.Create)
 	router.HandleFunc("GET /{org}/{repo}/{page}/comments", commentHandler.GetAll)
 	router.HandleFunc("PATCH /{org}/{repo}/{page}/comments", commentHandler.Resolve)
+	router.HandleFunc("PUT /{org}/{repo}/{page}/comments", commentHandler.Edit)
+	router.HandleFunc("GET /{org}/{repo}/{page}/comments/stream", commentHandler.Stream)
+	router.HandleFunc("POST /{org}/{repo}/{page}/comments/{id}/reactions", commentHandler.AddReaction)
+	router.HandleFunc("DELETE /{org}/{repo}/{page}/comments/{id}/reactions/{content}", commentHandler.RemoveReaction)
+
+	hub := presence.NewHub(50, 30*time.Minute)
+	go hub.Run(ctx)
+
+	presenceHandler := &presence.Handler{Hub: hub, AllowedOrigins: cfg.AllowedOrigins, Sessions: sessions, Sites: registry}
+
+	router.HandleFunc("GET /{org}/{repo}/{page}/presence", presenceHandler.Join)
 
 	router.HandleFunc("POST /{org}/{repo}/permissions", commentHandler.Permissions)
 	router.HandleFunc("GET /{org}/{repo}/setup", commentHandler.Setup)
+	router.HandleFunc("GET /{org}/{repo}/comments", commentHandler.List)
+	router.HandleFunc("POST /{org}/{repo}/comments/batch", commentHandler.Batch)
+	router.HandleFunc("GET /{org}/{repo}/stats", commentHandler.Stats)
+	router.HandleFunc("GET /{org}/{repo}/export", commentHandler.Export)
+
+	indexer := &search.Indexer{Store: st}
+	go indexer.Run(ctx, broker)
 
-	authHandler := &auth.Handler{}
+	searchHandler := &search.Handler{Audit: auditLog, Store: st, Indexer: indexer, Sessions: sessions, Sites: registry, GitHubToken: githubToken}
+
+	router.HandleFunc("GET /{org}/{repo}/search", searchHandler.Search)
+	router.HandleFunc("POST /{org}/{repo}/search/reindex", searchHandler.Reindex)
+
+	authHandler := &auth.Handler{
+		Store:         st,
+		Sessions:      sessions,
+		OAuthClientID: cfg.GitHub.OAuthClientID,
+		OAuthSecret:   cfg.GitHub.OAuthSecret,
+		CookieDomain:  cfg.CookieDomain,
+		Sites:         registry,
+	}
 
 	router.HandleFunc("GET /auth", authHandler.StartAuth)
 	router.HandleFunc("GET /auth/callback", authHandler.AuthCallback)
 	router.HandleFunc("GET /me", authHandler.GetUser)
 
+	notifyHandler := &notify.Handler{Store: st, Sessions: sessions, Sites: registry}
+
+	router.HandleFunc("GET /me/notifications", notifyHandler.GetPreferences)
+	router.HandleFunc("PUT /me/notifications", notifyHandler.UpdatePreferences)
+	router.HandleFunc("GET /me/subscriptions", notifyHandler.ListSubscriptions)
+	router.HandleFunc("POST /me/subscriptions", notifyHandler.Subscribe)
+	router.HandleFunc("DELETE /me/subscriptions", notifyHandler.Unsubscribe)
+	router.HandleFunc("POST /me/mutes", notifyHandler.MuteThread)
+	router.HandleFunc("DELETE /me/mutes/{id}", notifyHandler.UnmuteThread)
+	router.HandleFunc("GET /me/inbox", notifyHandler.Inbox)
+	router.HandleFunc("POST /me/inbox/read", notifyHandler.MarkPageRead)
+	router.HandleFunc("POST /me/inbox/read-all", notifyHandler.MarkAllRead)
+
+	ingestHandler := &ingest.Handler{Events: broker, Secret: cfg.GitHub.WebhookSecret}
+
+	router.HandleFunc("POST /webhooks/github", ingestHandler.GitHub)
+
+	webhookDispatcher := &webhooks.Dispatcher{Store: st}
+	go webhookDispatcher.Run(ctx, broker)
+
+	adminHandler := &admin.Handler{Store: st, Sites: registry, Events: broker, Audit: auditLog, Sessions: sessions, GitHubToken: githubToken}
+	adminHandler.Register(router)
+
+	router.Handle("GET /metrics", metrics.Handler(cfg.MetricsToken))
+
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "https://commentasaurus.nickrucinski.com"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowOriginFunc: func(origin string) bool {
+			return slices.Contains(cfg.AllowedOrigins, origin) || registry.AllowsOrigin(origin)
+		},
+		AllowedMethods:   []string{"GET", "POST", "OPTIONS", "PATCH", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Last-Event-ID", sites.Header, logging.RequestIDHeader},
+		ExposedHeaders:   []string{logging.RequestIDHeader},
 		AllowCredentials: true,
 	}).Handler(router)
 
-	return corsHandler
+	disconnect = func() {
+		broker.DisconnectAll()
+		hub.DisconnectAll()
+	}
+	return logging.Middleware(metrics.Middleware(corsHandler)), disconnect, nil
 }
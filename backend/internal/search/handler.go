@@ -0,0 +1,194 @@
+package search
+
+import (
+	"cmp"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/audit"
+	"github.com/NicholasRucinski/commentasaurus/internal/auth"
+	"github.com/NicholasRucinski/commentasaurus/internal/crypto"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/sites"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type Handler struct {
+	Audit    *audit.Log
+	Store    *store.Store
+	Indexer  *Indexer
+	Sessions *auth.Sessions
+	Sites    *sites.Registry
+	// GitHubToken reads repos when reindexing.
+	GitHubToken string
+}
+
+type Response struct {
+	Results []store.SearchResult `json:"results"`
+	Total   int                  `json:"total"`
+}
+
+// Search looks up comments in one repo. Query parameters: q, status (open,
+// resolved or all), limit, offset and the page's permission_level.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+
+	target, err := h.Sites.Resolve(r)
+	if err != nil {
+		sites.Error(w, err)
+		return
+	}
+	if !h.canSearch(r, org, repo, target.Level) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	match := Match(query.Get("q"))
+	if match == "" {
+		http.Error(w, "Missing ?q= query parameter", http.StatusBadRequest)
+		return
+	}
+
+	status := cmp.Or(query.Get("status"), "all")
+	if status != "open" && status != "resolved" && status != "all" {
+		http.Error(w, "status must be open, resolved or all", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(query.Get("limit"), defaultLimit)
+	if err != nil || limit < 1 {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	results, total, err := h.Store.Search(store.SearchQuery{
+		Match:  match,
+		Org:    org,
+		Repo:   repo,
+		Status: status,
+		Limit:  min(limit, maxLimit),
+		Offset: offset,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "search failed", "err", err)
+		http.Error(w, "search failed", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range results {
+		results[i].BodySnippet = Highlight(results[i].BodySnippet)
+		// FTS5 returns the start of a column even when nothing in it matched.
+		if strings.Contains(results[i].TextSnippet, store.HighlightStart) {
+			results[i].TextSnippet = Highlight(results[i].TextSnippet)
+		} else {
+			results[i].TextSnippet = ""
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Results: results, Total: total})
+}
+
+// canSearch applies the same rules as reading a page's comments. The index
+// is local, so outside anonymous mode the caller's own token has to prove
+// they can see the repository on GitHub.
+func (h *Handler) canSearch(r *http.Request, org, repo, level string) bool {
+	if level == "anon" {
+		return true
+	}
+
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		return false
+	}
+	if level == "team" && !viewer.IsInOrg([]string{org}) {
+		return false
+	}
+
+	tokenCookie, err := r.Cookie("github_token")
+	if err != nil {
+		return false
+	}
+	githubToken, err := crypto.Decrypt([]byte(h.Sessions.CookieKey), tokenCookie.Value)
+	if err != nil {
+		return false
+	}
+	if _, err := utils.GetRepositoryID(logging.Client(r.Context()), githubToken, org, repo); err != nil {
+		slog.InfoContext(r.Context(), "search: repo not visible to user", "login", viewer.Login, "org", org, "repo", repo, "err", err)
+		return false
+	}
+	return true
+}
+
+// Reindex rebuilds the index for a repo from GitHub. Admins only.
+func (h *Handler) Reindex(w http.ResponseWriter, r *http.Request) {
+	viewer, err := h.Sessions.User(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.Sessions.IsAdmin(viewer) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	githubToken := h.GitHubToken
+	if githubToken == "" {
+		http.Error(w, "Missing GitHub config", http.StatusInternalServerError)
+		return
+	}
+
+	target, err := h.Sites.Resolve(r)
+	if err != nil {
+		sites.Error(w, err)
+		return
+	}
+
+	org := r.PathValue("org")
+	repo := r.PathValue("repo")
+	client := logging.Client(r.Context())
+
+	categoryID := target.CategoryID
+	if categoryID == "" {
+		categoryID, err = utils.FindOrCreateCommentsCategory(client, githubToken, org, repo, cmp.Or(r.URL.Query().Get("category_name"), "General"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	indexed, err := h.Indexer.Reindex(client, githubToken, org, repo, categoryID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "reindex failed", "org", org, "repo", repo, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "reindexed comments", "count", indexed, "org", org, "repo", repo, "login", viewer.Login)
+	h.Audit.Record(r, audit.Entry{Actor: viewer.Login, Action: "search.reindex", Target: org + "/" + repo, Org: org, Repo: repo})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"indexed": indexed})
+}
+
+func intParam(v string, fallback int) (int, error) {
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(v)
+}
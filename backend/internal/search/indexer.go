@@ -0,0 +1,83 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// Indexer keeps the search index in step with comment events, which cover
+// both our own writes and changes reported by the GitHub webhook.
+type Indexer struct {
+	Store *store.Store
+}
+
+func (ix *Indexer) Run(ctx context.Context, broker *events.Broker) {
+	broker.Listen(ctx, ix.handle)
+}
+
+func (ix *Indexer) handle(e events.Event) {
+	var err error
+	switch e.Type {
+	case events.Created, events.Edited, events.Resolved:
+		err = ix.Store.IndexComment(document(e.Org, e.Repo, e.Comment))
+	case events.Deleted:
+		err = ix.Store.RemoveComment(e.Comment.ID)
+	}
+	if err != nil {
+		slog.Error("search: indexing failed", "event", e.Type, "comment", e.Comment.ID, "err", err)
+	}
+}
+
+// Reindex indexes every comment in the repo's comment category. It is how
+// comments written before the index existed become searchable.
+func (ix *Indexer) Reindex(client *http.Client, githubToken, org, repo, categoryID string) (int, error) {
+	discussions, err := utils.ListPageDiscussions(client, githubToken, org, repo, categoryID)
+	if err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, d := range discussions {
+		if err := ix.IndexComments(org, repo, d.Comments); err != nil {
+			return indexed, err
+		}
+		indexed += len(d.Comments)
+	}
+	return indexed, nil
+}
+
+// IndexComments indexes comments from one repo, such as a page restored
+// from a backup. Top-level comments must come before their replies.
+func (ix *Indexer) IndexComments(org, repo string, comments []utils.Comment) error {
+	for _, c := range comments {
+		if err := ix.Store.IndexComment(document(org, repo, c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func document(org, repo string, c utils.Comment) store.SearchDocument {
+	thread := c.ReplyTo
+	if thread == "" {
+		thread = c.ID
+	}
+	return store.SearchDocument{
+		CommentID: c.ID,
+		ThreadID:  thread,
+		Org:       org,
+		Repo:      repo,
+		Page:      c.Page,
+		Author:    c.User,
+		Resolved:  c.Resolved,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Comment,
+		Text:      c.Text,
+	}
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"html"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+// Match turns what a user typed into an FTS5 query. Every word must appear,
+// "quoted text" is matched as a phrase and a trailing * matches a prefix.
+// FTS5 operators are treated as plain words so no input is a syntax error.
+func Match(input string) string {
+	var terms []string
+	for len(input) > 0 {
+		input = strings.TrimLeft(input, " \t\r\n")
+		if input == "" {
+			break
+		}
+
+		var term string
+		if input[0] == '"' {
+			end := strings.IndexByte(input[1:], '"')
+			if end < 0 {
+				term, input = input[1:], ""
+			} else {
+				term, input = input[1:end+1], input[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(input, " \t\r\n\"")
+			if end < 0 {
+				end = len(input)
+			}
+			term, input = input[:end], input[end:]
+		}
+
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimSpace(strings.TrimRight(term, "*"))
+		if term == "" {
+			continue
+		}
+		quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			quoted += "*"
+		}
+		terms = append(terms, quoted)
+	}
+	return strings.Join(terms, " ")
+}
+
+// Highlight escapes a snippet from the store and marks matches with <mark>.
+func Highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, store.HighlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, store.HighlightEnd, "</mark>")
+}
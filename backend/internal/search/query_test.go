@@ -0,0 +1,98 @@
+package search
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+func TestMatch(t *testing.T) {
+	for input, want := range map[string]string{
+		"broken link":          `"broken" "link"`,
+		`"broken link" docs`:   `"broken link" "docs"`,
+		"resolv*":              `"resolv"*`,
+		"a AND b OR NOT c":     `"a" "AND" "b" "OR" "NOT" "c"`,
+		`title:x ^y (z) -w`:    `"title:x" "^y" "(z)" "-w"`,
+		`say "hi`:              `"say" "hi"`,
+		`"" * ** "   "`:        ``,
+		"tab\tnew\nline":       `"tab" "new" "line"`,
+		`it"s`:                 `"it" "s"`,
+		`NEAR(a b, 2) "x" "y"`: `"NEAR(a" "b," "2)" "x" "y"`,
+	} {
+		if got := Match(input); got != want {
+			t.Errorf("Match(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+// Whatever a reader types has to run as a query rather than fail with an
+// FTS5 syntax error.
+func TestMatchRunsInFTS(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for _, doc := range []store.SearchDocument{
+		{CommentID: "c1", Body: "This link is broken", Text: "see the install guide"},
+		{CommentID: "c2", Body: "The broken build was resolved", Text: "CI"},
+		{CommentID: "c3", Body: "AND is a keyword; so is NOT", Text: "operators"},
+	} {
+		doc.ThreadID, doc.Org, doc.Repo, doc.Page = doc.CommentID, "acme", "docs", "/intro"
+		doc.CreatedAt, doc.UpdatedAt = "2026-01-01T00:00:00Z", "2026-01-01T00:00:00Z"
+		if err := st.IndexComment(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(input string) []string {
+		t.Helper()
+		// The handler turns these away before they get here.
+		if Match(input) == "" {
+			return nil
+		}
+		results, _, err := st.Search(store.SearchQuery{Match: Match(input), Org: "acme", Repo: "docs", Limit: 10})
+		if err != nil {
+			t.Fatalf("Search(%q) as %s: %v", input, Match(input), err)
+		}
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.CommentID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	for _, input := range []string{
+		`"`, `"unterminated phrase`, `*`, `a*b*`, `(`, `)`, `^`, `-broken`, `broken OR`, `NOT`, `AND AND`,
+		`NEAR(broken link)`, `body:broken`, `{body text}:link`, `'; DROP TABLE search_documents; --`, `\"`,
+	} {
+		search(input)
+	}
+
+	for input, want := range map[string][]string{
+		"broken":        {"c1", "c2"},
+		"BROKEN link":   {"c1"},
+		`"link is"`:     {"c1"},
+		`"is link"`:     nil,
+		"brok*":         {"c1", "c2"},
+		"brok":          nil,
+		"AND NOT":       {"c3"},
+		"install guide": {"c1"},
+	} {
+		if got := search(input); !slices.Equal(got, want) {
+			t.Errorf("search %q = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	snippet := "fix <script>" + store.HighlightStart + "alert" + store.HighlightEnd + "</script> & co"
+	want := "fix &lt;script&gt;<mark>alert</mark>&lt;/script&gt; &amp; co"
+	if got := Highlight(snippet); got != want {
+		t.Errorf("Highlight = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+// Package server runs the HTTP server with timeouts, optional TLS and a
+// graceful shutdown.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+)
+
+// New builds a server for handler from cfg. With a certificate configured it
+// serves HTTPS, picking up renewed certificates without a restart.
+func New(cfg *config.Config, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	if cfg.Server.TLSCert != "" {
+		cert, err := LoadCertificate(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: cert.Get,
+		}
+		go reloadOnHangup(cert)
+	}
+	return srv, nil
+}
+
+// Run serves until ctx is done, then stops accepting connections and gives
+// in-flight requests up to cfg.Server.ShutdownTimeout to finish. Connections
+// still open after that are closed.
+func Run(ctx context.Context, srv *http.Server, cfg *config.Config) error {
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS("", "")
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("server: shutting down, waiting for requests to finish", "timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("requests still running after %s were cut off", cfg.Server.ShutdownTimeout)
+		}
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func reloadOnHangup(cert *Certificate) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := cert.Reload(); err != nil {
+			slog.Error("server: reloading TLS certificate failed", "err", err)
+			continue
+		}
+		slog.Info("server: reloaded TLS certificate")
+	}
+}
@@ -0,0 +1,389 @@
+// Package sites maps site IDs to the repo, discussion category and access
+// rules of each Docusaurus site served by this deployment.
+package sites
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/config"
+	"github.com/NicholasRucinski/commentasaurus/internal/logging"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+// Header can name the site instead of the site query parameter.
+const Header = "X-Commentasaurus-Site"
+
+var (
+	ErrSiteRequired = errors.New("site is required")
+	ErrUnknownSite  = errors.New("unknown site")
+	ErrWrongRepo    = errors.New("site does not belong to this repo")
+	ErrOrigin       = errors.New("origin not allowed for this site")
+	ErrReadOnly     = errors.New("site is set in the config file")
+)
+
+// Entry is a registered site and where it came from, config or api.
+type Entry struct {
+	store.Site
+	Source   string                    `json:"source"`
+	Override *store.PermissionOverride `json:"permissionOverride,omitempty"`
+}
+
+// Level is the site's permission level once any override is applied.
+func (e Entry) Level() string {
+	if e.Override != nil {
+		return e.Override.PermissionLevel
+	}
+	return e.PermissionLevel
+}
+
+// Target is what a request acts on once its site has been looked up. Site is
+// nil for requests that don't name one, which only happens while no sites
+// are registered.
+type Target struct {
+	Site       *store.Site
+	CategoryID string
+	RepoID     string
+	Level      string
+}
+
+type Registry struct {
+	store       *store.Store
+	githubToken string
+
+	mu    sync.RWMutex
+	sites map[string]Entry
+}
+
+// NewRegistry loads sites from the config and the store. A stored site with
+// the same ID as a configured one is ignored. githubToken looks up IDs the
+// sites leave out.
+func NewRegistry(st *store.Store, configured []config.Site, githubToken string) (*Registry, error) {
+	reg := &Registry{store: st, githubToken: githubToken, sites: map[string]Entry{}}
+	for _, c := range configured {
+		reg.sites[c.ID] = Entry{Source: "config", Site: store.Site{
+			ID:              c.ID,
+			Org:             c.Org,
+			Repo:            c.Repo,
+			CategoryName:    c.Category,
+			CategoryID:      c.CategoryID,
+			RepoID:          c.RepoID,
+			PermissionLevel: c.PermissionLevel,
+			AllowedOrigins:  c.AllowedOrigins,
+			CookieDomain:    c.CookieDomain,
+		}}
+	}
+
+	if st == nil {
+		return reg, nil
+	}
+	stored, err := st.Sites()
+	if err != nil {
+		return nil, fmt.Errorf("sites: loading: %w", err)
+	}
+	for _, site := range stored {
+		if _, ok := reg.sites[site.ID]; ok {
+			slog.Warn("sites: site is set in the config file, ignoring the stored copy", "site", site.ID)
+			continue
+		}
+		reg.sites[site.ID] = Entry{Site: site, Source: "api"}
+	}
+
+	overrides, err := st.PermissionOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("sites: loading permission overrides: %w", err)
+	}
+	for _, o := range overrides {
+		if e, ok := reg.sites[o.SiteID]; ok {
+			e.Override = &o
+			reg.sites[o.SiteID] = e
+		}
+	}
+	return reg, nil
+}
+
+func (reg *Registry) Len() int {
+	if reg == nil {
+		return 0
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return len(reg.sites)
+}
+
+func (reg *Registry) Get(id string) (Entry, bool) {
+	if reg == nil {
+		return Entry{}, false
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	e, ok := reg.sites[id]
+	return e, ok
+}
+
+func (reg *Registry) List() []Entry {
+	if reg == nil {
+		return []Entry{}
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	entries := make([]Entry, 0, len(reg.sites))
+	for _, e := range reg.sites {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.ID, b.ID) })
+	return entries
+}
+
+// Put validates and saves a site registered through the API.
+func (reg *Registry) Put(site store.Site) (Entry, error) {
+	if err := Validate(site); err != nil {
+		return Entry{}, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if e, ok := reg.sites[site.ID]; ok && e.Source == "config" {
+		return Entry{}, ErrReadOnly
+	}
+	saved, err := reg.store.PutSite(site)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Site: saved, Source: "api", Override: reg.sites[site.ID].Override}
+	reg.sites[site.ID] = e
+	return e, nil
+}
+
+// SetPermission overrides the permission level of any site, including ones
+// from the config file.
+func (reg *Registry) SetPermission(id, level, updatedBy string) (Entry, error) {
+	if err := config.ValidatePermissionLevel(level); err != nil {
+		return Entry{}, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	e, ok := reg.sites[id]
+	if !ok {
+		return Entry{}, ErrUnknownSite
+	}
+	o, err := reg.store.SetPermissionOverride(store.PermissionOverride{SiteID: id, PermissionLevel: level, UpdatedBy: updatedBy})
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Override = &o
+	reg.sites[id] = e
+	return e, nil
+}
+
+// ClearPermission drops an override, going back to the site's own level.
+func (reg *Registry) ClearPermission(id string) (Entry, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	e, ok := reg.sites[id]
+	if !ok {
+		return Entry{}, ErrUnknownSite
+	}
+	if err := reg.store.ClearPermissionOverride(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return Entry{}, err
+	}
+	e.Override = nil
+	reg.sites[id] = e
+	return e, nil
+}
+
+func (reg *Registry) Delete(id string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	e, ok := reg.sites[id]
+	if !ok {
+		return ErrUnknownSite
+	}
+	if e.Source == "config" {
+		return ErrReadOnly
+	}
+	if err := reg.store.DeleteSite(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if err := reg.store.ClearPermissionOverride(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	delete(reg.sites, id)
+	return nil
+}
+
+func Validate(site store.Site) error {
+	if site.ID == "" {
+		return errors.New("id is required")
+	}
+	if site.Org == "" || site.Repo == "" {
+		return errors.New("org and repo are required")
+	}
+	if err := config.ValidatePermissionLevel(site.PermissionLevel); err != nil {
+		return err
+	}
+	for _, origin := range site.AllowedOrigins {
+		if err := config.ValidateOrigin(origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LevelFor returns the strictest permission level among the sites serving
+// org/repo. ok is false when no site serves it.
+func (reg *Registry) LevelFor(org, repo string) (level string, ok bool) {
+	strictness := map[string]int{"anon": 0, "auth": 1, "team": 2}
+	for _, e := range reg.List() {
+		if !strings.EqualFold(e.Org, org) || !strings.EqualFold(e.Repo, repo) {
+			continue
+		}
+		if !ok || strictness[e.Level()] > strictness[level] {
+			level = e.Level()
+		}
+		ok = true
+	}
+	return level, ok
+}
+
+// CanRead reports whether a signed-in user may read the comments of
+// org/repo, for requests and jobs that aren't tied to one site, such as
+// subscriptions. isMember, checking the user belongs to org, is only called
+// for team-only repos. Repos no site serves are readable while no sites are
+// registered, since their level then comes from the plugin.
+func (reg *Registry) CanRead(org, repo string, isMember func() (bool, error)) (bool, error) {
+	level, ok := reg.LevelFor(org, repo)
+	if !ok {
+		return reg.Len() == 0, nil
+	}
+	if level == "team" {
+		return isMember()
+	}
+	return true, nil
+}
+
+// AllowsOrigin reports whether any site lists origin.
+func (reg *Registry) AllowsOrigin(origin string) bool {
+	_, ok := reg.forOrigin(origin)
+	return ok
+}
+
+// CookieDomainFor returns the cookie domain of the site that lists origin.
+// ok is false when no site lists it or that site doesn't set a domain.
+func (reg *Registry) CookieDomainFor(origin string) (string, bool) {
+	site, ok := reg.forOrigin(origin)
+	if !ok || site.CookieDomain == "" {
+		return "", false
+	}
+	return site.CookieDomain, true
+}
+
+func (reg *Registry) forOrigin(origin string) (store.Site, bool) {
+	if reg == nil || origin == "" {
+		return store.Site{}, false
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, e := range reg.sites {
+		if slices.Contains(e.AllowedOrigins, origin) {
+			return e.Site, true
+		}
+	}
+	return store.Site{}, false
+}
+
+// Resolve finds the site a request names with ?site= or the Site header and
+// checks it belongs to the {org}/{repo} in the path. Requests that don't
+// name a site fall back to the category_id, repo_id and permission_level
+// query parameters, but only while no sites are registered.
+func (reg *Registry) Resolve(r *http.Request) (Target, error) {
+	q := r.URL.Query()
+	id := cmp.Or(q.Get("site"), r.Header.Get(Header))
+	if id == "" {
+		if reg.Len() > 0 {
+			return Target{}, ErrSiteRequired
+		}
+		return Target{
+			CategoryID: q.Get("category_id"),
+			RepoID:     q.Get("repo_id"),
+			Level:      q.Get("permission_level"),
+		}, nil
+	}
+
+	e, ok := reg.Get(id)
+	if !ok {
+		return Target{}, ErrUnknownSite
+	}
+	site := e.Site
+	level := e.Level()
+	if !strings.EqualFold(site.Org, r.PathValue("org")) || !strings.EqualFold(site.Repo, r.PathValue("repo")) {
+		return Target{}, ErrWrongRepo
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && len(site.AllowedOrigins) > 0 && !slices.Contains(site.AllowedOrigins, origin) {
+		return Target{}, ErrOrigin
+	}
+
+	cached := site.CategoryID != "" && site.RepoID != ""
+	metrics.CacheLookup("site_ids", cached)
+	if !cached {
+		var err error
+		if site, err = reg.lookupIDs(r.Context(), site); err != nil {
+			return Target{}, err
+		}
+	}
+	return Target{Site: &site, CategoryID: site.CategoryID, RepoID: site.RepoID, Level: level}, nil
+}
+
+// lookupIDs fills in the category and repo IDs from GitHub and remembers
+// them until the site is next changed.
+func (reg *Registry) lookupIDs(ctx context.Context, site store.Site) (store.Site, error) {
+	githubToken := reg.githubToken
+	client := logging.Client(ctx)
+
+	var err error
+	if site.CategoryID == "" {
+		site.CategoryID, err = utils.FindOrCreateCommentsCategory(client, githubToken, site.Org, site.Repo, cmp.Or(site.CategoryName, "General"))
+		if err != nil {
+			return site, fmt.Errorf("sites: looking up category for %s: %w", site.ID, err)
+		}
+	}
+	if site.RepoID == "" {
+		site.RepoID, err = utils.GetRepositoryID(client, githubToken, site.Org, site.Repo)
+		if err != nil {
+			return site, fmt.Errorf("sites: looking up repo for %s: %w", site.ID, err)
+		}
+	}
+
+	reg.mu.Lock()
+	if e, ok := reg.sites[site.ID]; ok && e.Org == site.Org && e.Repo == site.Repo && e.CategoryName == site.CategoryName {
+		e.CategoryID, e.RepoID = site.CategoryID, site.RepoID
+		reg.sites[site.ID] = e
+	}
+	reg.mu.Unlock()
+	return site, nil
+}
+
+// Error writes the response for an error from Resolve.
+func Error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSiteRequired):
+		http.Error(w, "Missing ?site= query parameter", http.StatusBadRequest)
+	case errors.Is(err, ErrUnknownSite):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrWrongRepo), errors.Is(err, ErrOrigin):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		slog.Error("sites: resolving site failed", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
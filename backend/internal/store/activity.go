@@ -0,0 +1,68 @@
+package store
+
+import "time"
+
+type Activity struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	Page      string    `json:"page"`
+	CommentID string    `json:"commentId"`
+	ThreadID  string    `json:"threadId"`
+	Actor     string    `json:"actor"`
+	Text      string    `json:"text"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Store) RecordActivity(a Activity) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO activity (type, org, repo, page, comment_id, thread_id, actor, text, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.Type, a.Org, a.Repo, a.Page, a.CommentID, a.ThreadID, a.Actor, a.Text, a.Comment, a.CreatedAt.UTC())
+	return err
+}
+
+// ActivityForSubscriber lists activity after since on every page, repo and
+// thread login follows, excluding their own actions and muted threads,
+// grouped by page and oldest first.
+func (s *Store) ActivityForSubscriber(login string, since time.Time) ([]Activity, error) {
+	rows, err := s.db.Query(`
+		SELECT a.id, a.type, a.org, a.repo, a.page, a.comment_id, a.thread_id, a.actor, a.text, a.comment, a.created_at
+		FROM activity a
+		WHERE a.created_at > ? AND a.actor != ? COLLATE NOCASE
+		  AND (
+			EXISTS (
+				SELECT 1 FROM subscriptions s
+				WHERE s.login = ? AND s.org = a.org AND s.repo = a.repo AND (s.page = '' OR s.page = a.page)
+			)
+			OR EXISTS (
+				SELECT 1 FROM thread_subscriptions t
+				WHERE t.login = ? AND t.thread_id = a.thread_id AND t.muted = 0
+			)
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM thread_subscriptions t
+			WHERE t.login = ? AND t.thread_id = a.thread_id AND t.muted = 1
+		  )
+		ORDER BY a.org, a.repo, a.page, a.created_at`,
+		since.UTC(), login, login, login, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.Type, &a.Org, &a.Repo, &a.Page, &a.CommentID, &a.ThreadID, &a.Actor, &a.Text, &a.Comment, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// AuditEntry records one mutating action. The hashes identify the state of
+// the target before and after without keeping its content.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target"`
+	Org        string    `json:"org,omitempty"`
+	Repo       string    `json:"repo,omitempty"`
+	Page       string    `json:"page,omitempty"`
+	BeforeHash string    `json:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+// AuditQuery narrows the audit log. Empty fields don't filter. BeforeID pages
+// backwards from the newest entry.
+type AuditQuery struct {
+	Actor    string
+	Action   string
+	Target   string
+	Org      string
+	Repo     string
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64
+	Limit    int
+}
+
+func (s *Store) AppendAudit(e AuditEntry) (AuditEntry, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO audit_log (created_at, actor, action, target, org, repo, page, before_hash, after_hash, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC(), e.Actor, e.Action, e.Target, e.Org, e.Repo, e.Page, e.BeforeHash, e.AfterHash, e.IP, e.UserAgent)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	e.ID, err = res.LastInsertId()
+	return e, err
+}
+
+// AuditEntries returns matching entries, newest first.
+func (s *Store) AuditEntries(q AuditQuery) ([]AuditEntry, error) {
+	var where []string
+	var args []any
+	add := func(clause string, arg any) {
+		where = append(where, clause)
+		args = append(args, arg)
+	}
+	if q.Actor != "" {
+		add("actor = ? COLLATE NOCASE", q.Actor)
+	}
+	if q.Action != "" {
+		add("action = ?", q.Action)
+	}
+	if q.Target != "" {
+		add("target = ?", q.Target)
+	}
+	if q.Org != "" {
+		add("org = ?", q.Org)
+	}
+	if q.Repo != "" {
+		add("repo = ?", q.Repo)
+	}
+	if !q.Since.IsZero() {
+		add("created_at >= ?", q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		add("created_at <= ?", q.Until.UTC())
+	}
+	if q.BeforeID > 0 {
+		add("id < ?", q.BeforeID)
+	}
+
+	query := `
+		SELECT id, created_at, actor, action, target, org, repo, page, before_hash, after_hash, ip, user_agent
+		FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.Actor, &e.Action, &e.Target, &e.Org, &e.Repo, &e.Page,
+			&e.BeforeHash, &e.AfterHash, &e.IP, &e.UserAgent); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetAuditRetention records how many days entries are kept, zero meaning
+// forever. The database refuses to delete entries any younger.
+func (s *Store) SetAuditRetention(days int) error {
+	_, err := s.db.Exec(`UPDATE audit_retention SET days = ? WHERE id = 1`, days)
+	return err
+}
+
+// PruneAudit deletes entries older than cutoff. It is the only way entries
+// leave the log.
+func (s *Store) PruneAudit(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM audit_log WHERE created_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,64 @@
+package store
+
+import "time"
+
+// Ban stops a user commenting. An empty Org bans them everywhere.
+type Ban struct {
+	Login     string    `json:"login"`
+	Org       string    `json:"org"`
+	Reason    string    `json:"reason"`
+	BannedBy  string    `json:"bannedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Store) Ban(b Ban) (Ban, error) {
+	b.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO bans (login, org, reason, banned_by, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (login, org) DO UPDATE SET
+			reason = excluded.reason, banned_by = excluded.banned_by, created_at = excluded.created_at`,
+		b.Login, b.Org, b.Reason, b.BannedBy, b.CreatedAt)
+	return b, err
+}
+
+func (s *Store) Unban(login, org string) error {
+	res, err := s.db.Exec(`DELETE FROM bans WHERE login = ? AND org = ?`, login, org)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Bans lists bans in org, or every ban when org is empty.
+func (s *Store) Bans(org string) ([]Ban, error) {
+	rows, err := s.db.Query(`
+		SELECT login, org, reason, banned_by, created_at FROM bans
+		WHERE ? = '' OR org = ?
+		ORDER BY created_at DESC`,
+		org, org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var b Ban
+		if err := rows.Scan(&b.Login, &b.Org, &b.Reason, &b.BannedBy, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// IsBanned reports whether login is banned in org or everywhere. GitHub
+// logins and org names are case-insensitive, so the match is too.
+func (s *Store) IsBanned(login, org string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM bans WHERE login = ? COLLATE NOCASE AND (org = '' OR org = ? COLLATE NOCASE)`, login, org).Scan(&n)
+	return n > 0, err
+}
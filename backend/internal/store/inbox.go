@@ -0,0 +1,107 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// InboxQuery selects unread activity for Login. Only comments from orgs the
+// user belongs to, or from threads they follow, are returned; the server has
+// no other record of which pages a user is allowed to read.
+type InboxQuery struct {
+	Login string
+	Orgs  []string
+	Limit int
+}
+
+// Inbox lists comments and replies created after the user's read marker for
+// their page, newest first, along with the total number unread.
+func (s *Store) Inbox(q InboxQuery) ([]Activity, int, error) {
+	where, args := inboxFilter(q)
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM activity a WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT a.id, a.type, a.org, a.repo, a.page, a.comment_id, a.thread_id, a.actor, a.text, a.comment, a.created_at
+		FROM activity a
+		WHERE `+where+`
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?`,
+		append(args, q.Limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	activity := []Activity{}
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.Type, &a.Org, &a.Repo, &a.Page, &a.CommentID, &a.ThreadID, &a.Actor, &a.Text, &a.Comment, &a.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		activity = append(activity, a)
+	}
+	return activity, total, rows.Err()
+}
+
+func inboxFilter(q InboxQuery) (string, []any) {
+	args := []any{q.Login}
+
+	visible := `EXISTS (
+			SELECT 1 FROM thread_subscriptions t
+			WHERE t.login = ? AND t.thread_id = a.thread_id AND t.muted = 0
+		)`
+	if len(q.Orgs) > 0 {
+		visible = `(a.org IN (?` + strings.Repeat(", ?", len(q.Orgs)-1) + `) OR ` + visible + `)`
+		for _, org := range q.Orgs {
+			args = append(args, org)
+		}
+	}
+	args = append(args, q.Login, q.Login, q.Login, q.Login)
+
+	where := `a.type = 'created' AND a.actor != ? COLLATE NOCASE
+		AND ` + visible + `
+		AND NOT EXISTS (
+			SELECT 1 FROM thread_subscriptions t
+			WHERE t.login = ? AND t.thread_id = a.thread_id AND t.muted = 1
+		)
+		AND a.created_at > COALESCE((SELECT inbox_read_at FROM users WHERE login = ?), '')
+		AND a.created_at > COALESCE((
+			SELECT read_at FROM read_markers r
+			WHERE r.login = ? AND r.org = a.org AND r.repo = a.repo AND r.page = a.page
+		), '')`
+	return where, args
+}
+
+// MarkPageRead clears the inbox for one page as of at.
+func (s *Store) MarkPageRead(login, org, repo, page string, at time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO read_markers (login, org, repo, page, read_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (login, org, repo, page) DO UPDATE SET read_at = MAX(read_markers.read_at, excluded.read_at)`,
+		login, org, repo, page, at.UTC())
+	return err
+}
+
+// MarkAllRead clears the whole inbox as of at. Page markers older than at
+// no longer mean anything and are dropped.
+func (s *Store) MarkAllRead(login string, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO users (login, inbox_read_at) VALUES (?, ?)
+		ON CONFLICT (login) DO UPDATE SET inbox_read_at = excluded.inbox_read_at`,
+		login, at.UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM read_markers WHERE login = ? AND read_at <= ?`, login, at.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+package store
+
+import "database/sql"
+
+// Snippets returned by Search wrap matches in these bytes so callers can
+// escape the text before turning them into markup.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SearchDocument is the indexed copy of a comment. Replies carry their
+// thread's resolved state so a whole thread can be filtered at once.
+type SearchDocument struct {
+	CommentID string `json:"id"`
+	ThreadID  string `json:"threadId"`
+	Org       string `json:"org"`
+	Repo      string `json:"repo"`
+	Page      string `json:"page"`
+	Author    string `json:"user"`
+	Resolved  bool   `json:"resolved"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+	Body      string `json:"comment"`
+	Text      string `json:"text"`
+}
+
+type SearchQuery struct {
+	// Match is an FTS5 query expression.
+	Match  string
+	Org    string
+	Repo   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	SearchDocument
+	BodySnippet string `json:"bodySnippet"`
+	TextSnippet string `json:"textSnippet"`
+}
+
+// IndexComment adds or refreshes a comment. A comment's thread never changes,
+// so the thread recorded when it was first indexed is kept, and only
+// top-level comments decide whether a thread is resolved.
+func (s *Store) IndexComment(doc SearchDocument) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO search_documents (comment_id, thread_id, org, repo, page, author, resolved, created_at, updated_at, body, text)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6,
+			CASE WHEN ?2 = ?1 THEN ?7 ELSE COALESCE((SELECT resolved FROM search_documents WHERE comment_id = ?2), 0) END,
+			?8, ?9, ?10, ?11)
+		ON CONFLICT (comment_id) DO UPDATE SET
+			page = excluded.page,
+			author = CASE WHEN excluded.author = '' THEN search_documents.author ELSE excluded.author END,
+			resolved = CASE WHEN search_documents.thread_id = search_documents.comment_id THEN excluded.resolved ELSE search_documents.resolved END,
+			created_at = CASE WHEN excluded.created_at = '' THEN search_documents.created_at ELSE excluded.created_at END,
+			updated_at = excluded.updated_at,
+			body = excluded.body,
+			text = excluded.text`,
+		doc.CommentID, doc.ThreadID, doc.Org, doc.Repo, doc.Page, doc.Author, doc.Resolved,
+		doc.CreatedAt, doc.UpdatedAt, doc.Body, doc.Text)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE search_documents
+		SET resolved = (SELECT resolved FROM search_documents WHERE comment_id = ?1)
+		WHERE thread_id = ?1 AND comment_id != ?1`,
+		doc.CommentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveComment drops a comment, and its replies if it started a thread.
+func (s *Store) RemoveComment(commentID string) error {
+	_, err := s.db.Exec(`DELETE FROM search_documents WHERE comment_id = ?1 OR thread_id = ?1`, commentID)
+	return err
+}
+
+// Search returns the best matches in one repo and the total number of
+// matches. Status is open, resolved, or empty for both.
+func (s *Store) Search(q SearchQuery) ([]SearchResult, int, error) {
+	where := `search_index MATCH ? AND d.org = ? AND d.repo = ?`
+	args := []any{q.Match, q.Org, q.Repo}
+	switch q.Status {
+	case "open":
+		where += ` AND d.resolved = 0`
+	case "resolved":
+		where += ` AND d.resolved = 1`
+	}
+
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM search_index JOIN search_documents d ON d.id = search_index.rowid
+		WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT d.comment_id, d.thread_id, d.org, d.repo, d.page, d.author, d.resolved, d.created_at, d.updated_at, d.body, d.text,
+			snippet(search_index, 0, char(2), char(3), '…', 24),
+			snippet(search_index, 1, char(2), char(3), '…', 24)
+		FROM search_index JOIN search_documents d ON d.id = search_index.rowid
+		WHERE `+where+`
+		ORDER BY rank
+		LIMIT ? OFFSET ?`,
+		append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var textSnippet sql.NullString
+		if err := rows.Scan(&r.CommentID, &r.ThreadID, &r.Org, &r.Repo, &r.Page, &r.Author, &r.Resolved,
+			&r.CreatedAt, &r.UpdatedAt, &r.Body, &r.Text, &r.BodySnippet, &textSnippet); err != nil {
+			return nil, 0, err
+		}
+		r.TextSnippet = textSnippet.String
+		results = append(results, r)
+	}
+	return results, total, rows.Err()
+}
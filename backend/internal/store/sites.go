@@ -0,0 +1,127 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// Site is one Docusaurus site served by this deployment. CategoryID and
+// RepoID may be empty, in which case they are looked up from Org, Repo and
+// CategoryName.
+type Site struct {
+	ID              string    `json:"id"`
+	Org             string    `json:"org"`
+	Repo            string    `json:"repo"`
+	CategoryName    string    `json:"categoryName"`
+	CategoryID      string    `json:"categoryId"`
+	RepoID          string    `json:"repoId"`
+	PermissionLevel string    `json:"permissionLevel"`
+	AllowedOrigins  []string  `json:"allowedOrigins"`
+	CookieDomain    string    `json:"cookieDomain"`
+	UpdatedBy       string    `json:"updatedBy,omitempty"`
+	UpdatedAt       time.Time `json:"updatedAt,omitzero"`
+}
+
+func (s *Store) Sites() ([]Site, error) {
+	rows, err := s.db.Query(`
+		SELECT id, org, repo, category_name, category_id, repo_id, permission_level,
+			allowed_origins, cookie_domain, updated_by, updated_at
+		FROM sites ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := []Site{}
+	for rows.Next() {
+		var site Site
+		var origins string
+		if err := rows.Scan(&site.ID, &site.Org, &site.Repo, &site.CategoryName, &site.CategoryID, &site.RepoID,
+			&site.PermissionLevel, &origins, &site.CookieDomain, &site.UpdatedBy, &site.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if origins != "" {
+			site.AllowedOrigins = strings.Split(origins, ",")
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
+
+// PutSite creates or replaces the site with site.ID.
+func (s *Store) PutSite(site Site) (Site, error) {
+	site.UpdatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO sites (id, org, repo, category_name, category_id, repo_id, permission_level,
+			allowed_origins, cookie_domain, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			org = excluded.org, repo = excluded.repo, category_name = excluded.category_name,
+			category_id = excluded.category_id, repo_id = excluded.repo_id,
+			permission_level = excluded.permission_level, allowed_origins = excluded.allowed_origins,
+			cookie_domain = excluded.cookie_domain, updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at`,
+		site.ID, site.Org, site.Repo, site.CategoryName, site.CategoryID, site.RepoID, site.PermissionLevel,
+		strings.Join(site.AllowedOrigins, ","), site.CookieDomain, site.UpdatedBy, site.UpdatedAt)
+	return site, err
+}
+
+func (s *Store) DeleteSite(id string) error {
+	res, err := s.db.Exec(`DELETE FROM sites WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PermissionOverride replaces a site's permission level without touching
+// the site itself, so it works for sites from the config file too.
+type PermissionOverride struct {
+	SiteID          string    `json:"siteId"`
+	PermissionLevel string    `json:"permissionLevel"`
+	UpdatedBy       string    `json:"updatedBy"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+func (s *Store) PermissionOverrides() ([]PermissionOverride, error) {
+	rows, err := s.db.Query(`SELECT site_id, permission_level, updated_by, updated_at FROM site_permissions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []PermissionOverride{}
+	for rows.Next() {
+		var o PermissionOverride
+		if err := rows.Scan(&o.SiteID, &o.PermissionLevel, &o.UpdatedBy, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+func (s *Store) SetPermissionOverride(o PermissionOverride) (PermissionOverride, error) {
+	o.UpdatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO site_permissions (site_id, permission_level, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (site_id) DO UPDATE SET
+			permission_level = excluded.permission_level, updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at`,
+		o.SiteID, o.PermissionLevel, o.UpdatedBy, o.UpdatedAt)
+	return o, err
+}
+
+func (s *Store) ClearPermissionOverride(siteID string) error {
+	res, err := s.db.Exec(`DELETE FROM site_permissions WHERE site_id = ?`, siteID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	_ "modernc.org/sqlite"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store keeps the server's own state: user preferences, subscriptions,
+// activity, read markers, the search index, registered sites, bans and the
+// audit log. Comments themselves still live in GitHub Discussions.
+type Store struct {
+	db *sql.DB
+}
+
+// migrations run in order, each exactly once. Append to the list; never edit
+// an entry that has shipped.
+var migrations = []string{
+	`CREATE TABLE users (
+		login TEXT PRIMARY KEY COLLATE NOCASE,
+		email TEXT NOT NULL DEFAULT '',
+		digest INTEGER NOT NULL DEFAULT 0,
+		last_digest_at TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE subscriptions (
+		login TEXT NOT NULL COLLATE NOCASE,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		page TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (login, org, repo, page)
+	);
+	CREATE TABLE activity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		page TEXT NOT NULL,
+		comment_id TEXT NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL DEFAULT '',
+		comment TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX activity_page ON activity (org, repo, page, created_at);`,
+	`CREATE TABLE webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		active INTEGER NOT NULL DEFAULT 1,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL,
+		last_status_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		delivered_at TIMESTAMP
+	);
+	CREATE INDEX webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+	CREATE INDEX webhook_deliveries_hook ON webhook_deliveries (webhook_id, created_at);`,
+	`ALTER TABLE activity ADD COLUMN thread_id TEXT NOT NULL DEFAULT '';
+	CREATE TABLE thread_subscriptions (
+		login TEXT NOT NULL COLLATE NOCASE,
+		thread_id TEXT NOT NULL,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		page TEXT NOT NULL,
+		muted INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (login, thread_id)
+	);
+	CREATE INDEX thread_subscriptions_thread ON thread_subscriptions (thread_id);`,
+	`ALTER TABLE users ADD COLUMN inbox_read_at TIMESTAMP;
+	CREATE TABLE read_markers (
+		login TEXT NOT NULL COLLATE NOCASE,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		page TEXT NOT NULL,
+		read_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (login, org, repo, page)
+	);
+	CREATE INDEX activity_created ON activity (created_at);`,
+	`CREATE TABLE search_documents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		comment_id TEXT NOT NULL UNIQUE,
+		thread_id TEXT NOT NULL,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		page TEXT NOT NULL,
+		author TEXT NOT NULL DEFAULT '',
+		resolved INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL DEFAULT '',
+		body TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX search_documents_repo ON search_documents (org, repo);
+	CREATE INDEX search_documents_thread ON search_documents (thread_id);
+	CREATE VIRTUAL TABLE search_index USING fts5 (
+		body, text,
+		content = 'search_documents', content_rowid = 'id',
+		tokenize = 'porter unicode61'
+	);
+	CREATE TRIGGER search_documents_ai AFTER INSERT ON search_documents BEGIN
+		INSERT INTO search_index (rowid, body, text) VALUES (new.id, new.body, new.text);
+	END;
+	CREATE TRIGGER search_documents_ad AFTER DELETE ON search_documents BEGIN
+		INSERT INTO search_index (search_index, rowid, body, text) VALUES ('delete', old.id, old.body, old.text);
+	END;
+	CREATE TRIGGER search_documents_au AFTER UPDATE ON search_documents BEGIN
+		INSERT INTO search_index (search_index, rowid, body, text) VALUES ('delete', old.id, old.body, old.text);
+		INSERT INTO search_index (rowid, body, text) VALUES (new.id, new.body, new.text);
+	END;`,
+	`CREATE TABLE sites (
+		id TEXT PRIMARY KEY,
+		org TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		category_name TEXT NOT NULL DEFAULT '',
+		category_id TEXT NOT NULL DEFAULT '',
+		repo_id TEXT NOT NULL DEFAULT '',
+		permission_level TEXT NOT NULL,
+		allowed_origins TEXT NOT NULL DEFAULT '',
+		cookie_domain TEXT NOT NULL DEFAULT '',
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);`,
+	`CREATE TABLE site_permissions (
+		site_id TEXT PRIMARY KEY,
+		permission_level TEXT NOT NULL,
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE bans (
+		login TEXT NOT NULL COLLATE NOCASE,
+		org TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+		reason TEXT NOT NULL DEFAULT '',
+		banned_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (login, org)
+	);`,
+	`CREATE TABLE audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		org TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+		repo TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+		page TEXT NOT NULL DEFAULT '',
+		before_hash TEXT NOT NULL DEFAULT '',
+		after_hash TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_log_created ON audit_log (created_at);
+	CREATE INDEX audit_log_target ON audit_log (target);
+	CREATE TRIGGER audit_log_append_only BEFORE UPDATE ON audit_log BEGIN
+		SELECT RAISE(ABORT, 'audit log is append-only');
+	END;`,
+	`CREATE INDEX activity_thread ON activity (thread_id);`,
+	`CREATE TABLE audit_retention (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		days INTEGER NOT NULL
+	);
+	INSERT INTO audit_retention (id, days) VALUES (1, 0);
+	CREATE TRIGGER audit_log_retained BEFORE DELETE ON audit_log
+	WHEN (SELECT days FROM audit_retention) <= 0
+		OR julianday(old.created_at) >= julianday('now', '-' || (SELECT days FROM audit_retention) || ' days')
+	BEGIN
+		SELECT RAISE(ABORT, 'audit log entries are kept until the retention period ends');
+	END;`,
+}
+
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite", path))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, serialising here avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("store: reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("store: applied migration", "version", i+1)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Subscription struct {
+	Login     string    `json:"-"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	Page      string    `json:"page,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ThreadSubscription follows a single comment and its replies. A muted
+// thread is never notified, even if its page or repo is watched.
+type ThreadSubscription struct {
+	Login     string    `json:"-"`
+	ThreadID  string    `json:"threadId"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	Page      string    `json:"page"`
+	Muted     bool      `json:"muted"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscribe watches a page, or the whole repo when page is empty.
+func (s *Store) Subscribe(sub Subscription) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO subscriptions (login, org, repo, page, created_at) VALUES (?, ?, ?, ?, ?)`,
+		sub.Login, sub.Org, sub.Repo, sub.Page, time.Now().UTC())
+	return err
+}
+
+func (s *Store) Unsubscribe(sub Subscription) error {
+	_, err := s.db.Exec(`DELETE FROM subscriptions WHERE login = ? AND org = ? AND repo = ? AND page = ?`,
+		sub.Login, sub.Org, sub.Repo, sub.Page)
+	return err
+}
+
+func (s *Store) Subscriptions(login string) ([]Subscription, error) {
+	rows, err := s.db.Query(`
+		SELECT login, org, repo, page, created_at FROM subscriptions
+		WHERE login = ? ORDER BY org, repo, page`, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.Login, &sub.Org, &sub.Repo, &sub.Page, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Subscribers returns everyone watching the page or its repo.
+func (s *Store) Subscribers(org, repo, page string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT login FROM subscriptions
+		WHERE org = ? AND repo = ? AND (page = '' OR page = ?)`,
+		org, repo, page)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, err
+		}
+		logins = append(logins, login)
+	}
+	return logins, rows.Err()
+}
+
+// SubscribeThread follows a thread. It leaves an existing mute in place so
+// commenting on a muted thread doesn't silently unmute it.
+func (s *Store) SubscribeThread(sub ThreadSubscription) error {
+	_, err := s.db.Exec(`
+		INSERT OR IGNORE INTO thread_subscriptions (login, thread_id, org, repo, page, muted, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?)`,
+		sub.Login, sub.ThreadID, sub.Org, sub.Repo, sub.Page, time.Now().UTC())
+	return err
+}
+
+// ThreadSubscription returns login's row for a thread, muted or not.
+func (s *Store) ThreadSubscription(login, threadID string) (ThreadSubscription, error) {
+	var sub ThreadSubscription
+	err := s.db.QueryRow(`
+		SELECT login, thread_id, org, repo, page, muted, created_at FROM thread_subscriptions
+		WHERE login = ? AND thread_id = ?`, login, threadID).
+		Scan(&sub.Login, &sub.ThreadID, &sub.Org, &sub.Repo, &sub.Page, &sub.Muted, &sub.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sub, ErrNotFound
+	}
+	return sub, err
+}
+
+// ThreadLocation finds the page a thread is on from its recorded activity.
+func (s *Store) ThreadLocation(threadID string) (org, repo, page string, err error) {
+	err = s.db.QueryRow(`SELECT org, repo, page FROM activity WHERE thread_id = ? LIMIT 1`, threadID).Scan(&org, &repo, &page)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", "", ErrNotFound
+	}
+	return org, repo, page, err
+}
+
+// MuteThread mutes a thread, adding it to login's threads if they didn't
+// follow it.
+func (s *Store) MuteThread(sub ThreadSubscription) error {
+	_, err := s.db.Exec(`
+		INSERT INTO thread_subscriptions (login, thread_id, org, repo, page, muted, created_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT (login, thread_id) DO UPDATE SET muted = 1`,
+		sub.Login, sub.ThreadID, sub.Org, sub.Repo, sub.Page, time.Now().UTC())
+	return err
+}
+
+// UnmuteThread only changes an existing row: an unmuted row lets the thread
+// into login's inbox, so it can't be created from a bare ID.
+func (s *Store) UnmuteThread(login, threadID string) error {
+	res, err := s.db.Exec(`UPDATE thread_subscriptions SET muted = 0 WHERE login = ? AND thread_id = ?`, login, threadID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ThreadSubscriptions(login string) ([]ThreadSubscription, error) {
+	rows, err := s.db.Query(`
+		SELECT login, thread_id, org, repo, page, muted, created_at FROM thread_subscriptions
+		WHERE login = ? ORDER BY created_at`, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []ThreadSubscription{}
+	for rows.Next() {
+		var sub ThreadSubscription
+		if err := rows.Scan(&sub.Login, &sub.ThreadID, &sub.Org, &sub.Repo, &sub.Page, &sub.Muted, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// ThreadSubscribers splits a thread's followers into those who want to hear
+// about it and those who muted it.
+func (s *Store) ThreadSubscribers(threadID string) (following, muted []string, err error) {
+	rows, err := s.db.Query(`SELECT login, muted FROM thread_subscriptions WHERE thread_id = ?`, threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var login string
+		var isMuted bool
+		if err := rows.Scan(&login, &isMuted); err != nil {
+			return nil, nil, err
+		}
+		if isMuted {
+			muted = append(muted, login)
+		} else {
+			following = append(following, login)
+		}
+	}
+	return following, muted, rows.Err()
+}
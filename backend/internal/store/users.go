@@ -0,0 +1,75 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type UserPreferences struct {
+	Login        string     `json:"login"`
+	Email        string     `json:"email"`
+	Digest       bool       `json:"digest"`
+	LastDigestAt *time.Time `json:"lastDigestAt,omitempty"`
+}
+
+// RecordUser remembers the email a user signed in with so notifications can
+// reach them later. An empty email never overwrites a known one.
+func (s *Store) RecordUser(login, email string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO users (login, email) VALUES (?, ?)
+		ON CONFLICT (login) DO UPDATE SET
+			email = CASE WHEN excluded.email = '' THEN users.email ELSE excluded.email END,
+			updated_at = CURRENT_TIMESTAMP`,
+		login, email)
+	return err
+}
+
+func (s *Store) GetUser(login string) (UserPreferences, error) {
+	var prefs UserPreferences
+	var lastDigest sql.NullTime
+	err := s.db.QueryRow(`SELECT login, email, digest, last_digest_at FROM users WHERE login = ?`, login).
+		Scan(&prefs.Login, &prefs.Email, &prefs.Digest, &lastDigest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserPreferences{Login: login}, nil
+	}
+	if lastDigest.Valid {
+		prefs.LastDigestAt = &lastDigest.Time
+	}
+	return prefs, err
+}
+
+func (s *Store) SetDigest(login string, digest bool) error {
+	_, err := s.db.Exec(`
+		INSERT INTO users (login, digest) VALUES (?, ?)
+		ON CONFLICT (login) DO UPDATE SET digest = excluded.digest, updated_at = CURRENT_TIMESTAMP`,
+		login, digest)
+	return err
+}
+
+func (s *Store) DigestUsers() ([]UserPreferences, error) {
+	rows, err := s.db.Query(`SELECT login, email, digest, last_digest_at FROM users WHERE digest = 1 AND email != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserPreferences
+	for rows.Next() {
+		var prefs UserPreferences
+		var lastDigest sql.NullTime
+		if err := rows.Scan(&prefs.Login, &prefs.Email, &prefs.Digest, &lastDigest); err != nil {
+			return nil, err
+		}
+		if lastDigest.Valid {
+			prefs.LastDigestAt = &lastDigest.Time
+		}
+		users = append(users, prefs)
+	}
+	return users, rows.Err()
+}
+
+func (s *Store) MarkDigestSent(login string, at time.Time) error {
+	_, err := s.db.Exec(`UPDATE users SET last_digest_at = ? WHERE login = ?`, at.UTC(), login)
+	return err
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead marks a delivery that ran out of retries. Together they
+	// form the dead-letter queue and can be redelivered by hand.
+	DeliveryDead = "dead"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Delivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhookId"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastStatusCode int        `json:"lastStatusCode"`
+	LastError      string     `json:"lastError"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+func (s *Store) CreateWebhook(h Webhook) (Webhook, error) {
+	h.CreatedAt = time.Now().UTC()
+	h.Active = true
+	res, err := s.db.Exec(`
+		INSERT INTO webhooks (org, repo, url, secret, events, active, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?)`,
+		h.Org, h.Repo, h.URL, h.Secret, strings.Join(h.Events, ","), h.CreatedBy, h.CreatedAt)
+	if err != nil {
+		return Webhook{}, err
+	}
+	h.ID, err = res.LastInsertId()
+	return h, err
+}
+
+func (s *Store) DeleteWebhook(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) SetWebhookSecret(id int64, secret string) error {
+	res, err := s.db.Exec(`UPDATE webhooks SET secret = ? WHERE id = ?`, secret, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) GetWebhook(id int64) (Webhook, error) {
+	row := s.db.QueryRow(`SELECT id, org, repo, url, secret, events, active, created_by, created_at FROM webhooks WHERE id = ?`, id)
+	h, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrNotFound
+	}
+	return h, err
+}
+
+// Webhooks lists hooks for org/repo. Empty arguments match everything.
+func (s *Store) Webhooks(org, repo string) ([]Webhook, error) {
+	rows, err := s.db.Query(`
+		SELECT id, org, repo, url, secret, events, active, created_by, created_at FROM webhooks
+		WHERE (? = '' OR org = ?) AND (? = '' OR repo = ?)
+		ORDER BY id`,
+		org, org, repo, repo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+func scanWebhook(row interface{ Scan(...any) error }) (Webhook, error) {
+	var h Webhook
+	var events string
+	if err := row.Scan(&h.ID, &h.Org, &h.Repo, &h.URL, &h.Secret, &events, &h.Active, &h.CreatedBy, &h.CreatedAt); err != nil {
+		return Webhook{}, err
+	}
+	h.Events = strings.Split(events, ",")
+	return h, nil
+}
+
+func (s *Store) EnqueueDelivery(d Delivery) error {
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		d.WebhookID, d.Event, d.Payload, DeliveryPending, now, now)
+	return err
+}
+
+// DueDeliveries returns pending deliveries whose next attempt is due.
+func (s *Store) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	rows, err := s.db.Query(deliveryColumns+`
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at LIMIT ?`,
+		DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// Deliveries is the delivery log for a webhook, newest first.
+func (s *Store) Deliveries(webhookID int64, status string, limit int) ([]Delivery, error) {
+	rows, err := s.db.Query(deliveryColumns+`
+		WHERE webhook_id = ? AND (? = '' OR status = ?)
+		ORDER BY id DESC LIMIT ?`,
+		webhookID, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (s *Store) GetDelivery(id int64) (Delivery, error) {
+	rows, err := s.db.Query(deliveryColumns+` WHERE id = ?`, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return Delivery{}, ErrNotFound
+	}
+	return deliveries[0], nil
+}
+
+func (s *Store) UpdateDelivery(d Delivery) error {
+	_, err := s.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, delivered_at = ?
+		WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastStatusCode, d.LastError, d.DeliveredAt, d.ID)
+	return err
+}
+
+// RequeueDelivery moves a delivery back onto the queue with a fresh set of
+// attempts, typically to retry something from the dead-letter queue.
+func (s *Store) RequeueDelivery(id int64) error {
+	res, err := s.db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ?`,
+		DeliveryPending, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `
+	SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at,
+		last_status_code, last_error, created_at, delivered_at
+	FROM webhook_deliveries`
+
+func scanDeliveries(rows *sql.Rows) ([]Delivery, error) {
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
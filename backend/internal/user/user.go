@@ -1,11 +1,16 @@
 package user
 
+import "time"
+
+// User is a signed-in GitHub user. Login is the GitHub login, which the
+// plugin reads as "name".
 type User struct {
-	ID        int64    `json:"id"`
-	Login     string   `json:"name"`
-	Email     string   `json:"email"`
-	AvatarUrl string   `json:"avatar_url"`
-	OrgLogins []string `json:"login"`
+	ID        int64     `json:"id"`
+	Login     string    `json:"name"`
+	Email     string    `json:"email"`
+	AvatarUrl string    `json:"avatar_url"`
+	OrgLogins []string  `json:"login"`
+	ExpiresAt time.Time `json:"-"`
 }
 
 func (u *User) IsInOrg(orgs []string) bool {
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BatchMode controls how much GetPagesComments fetches for each page.
+type BatchMode string
+
+const (
+	BatchCount BatchMode = "count"
+	BatchOpen  BatchMode = "open"
+	BatchFull  BatchMode = "full"
+)
+
+// PageComments summarises one page. Count includes replies, Open is the
+// number of unresolved threads, and Comments is only filled in BatchFull
+// mode, in the same shape GetComments returns.
+type PageComments struct {
+	Count    int       `json:"count"`
+	Open     *int      `json:"open,omitempty"`
+	Comments []Comment `json:"comments,omitempty"`
+}
+
+var batchFields = map[BatchMode]string{
+	BatchCount: `
+            replies {
+              totalCount
+            }`,
+	BatchOpen: `
+            body
+            replies {
+              totalCount
+            }`,
+	BatchFull: `
+            id
+            body
+            author {
+              login
+            }
+            createdAt
+            updatedAt
+            reactionGroups {
+              content
+              viewerHasReacted
+              reactors {
+                totalCount
+              }
+            }
+            replies(first: 50) {
+              totalCount
+              nodes {
+                id
+                body
+                author {
+                  login
+                }
+                createdAt
+                updatedAt
+                reactionGroups {
+                  content
+                  viewerHasReacted
+                  reactors {
+                    totalCount
+                  }
+                }
+                replyTo {
+                  id
+                  author {
+                    login
+                  }
+                }
+              }
+            }`,
+}
+
+// GetPagesComments looks up several pages in a single GraphQL request, one
+// aliased discussion search per page. Pages without a discussion yet are
+// reported as empty rather than created.
+func GetPagesComments(client *http.Client, githubToken, owner, repo string, pages []string, mode BatchMode) (map[string]PageComments, error) {
+	fields, ok := batchFields[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown batch mode %q", mode)
+	}
+
+	var params, selections strings.Builder
+	variables := map[string]interface{}{}
+	for i, page := range pages {
+		if i > 0 {
+			params.WriteString(", ")
+		}
+		fmt.Fprintf(&params, "$q%d: String!", i)
+		fmt.Fprintf(&selections, `
+  p%d: search(query: $q%d, type: DISCUSSION, first: 5) {
+    nodes {
+      ... on Discussion {
+        title
+        comments(first: 50) {
+          totalCount
+          nodes {%s
+          }
+        }
+      }
+    }
+  }`, i, i, fields)
+		variables[fmt.Sprintf("q%d", i)] = fmt.Sprintf("repo:%s/%s in:title \"Page: %s\"", owner, repo, page)
+	}
+
+	reqBody := GraphQLRequest{
+		Query:     fmt.Sprintf("query GetPagesComments(%s) {%s\n}", params.String(), selections.String()),
+		Variables: variables,
+	}
+
+	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching pages: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+	}
+
+	var result struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("error decoding pages: %w", err)
+	}
+	if result.Data == nil && len(result.Errors) > 0 {
+		return nil, fmt.Errorf("GitHub API error: %s", result.Errors[0].Message)
+	}
+
+	summaries := make(map[string]PageComments, len(pages))
+	for i, page := range pages {
+		var search struct {
+			Nodes []struct {
+				Title    string `json:"title"`
+				Comments struct {
+					TotalCount int           `json:"totalCount"`
+					Nodes      []commentNode `json:"nodes"`
+				} `json:"comments"`
+			} `json:"nodes"`
+		}
+		if raw, ok := result.Data[fmt.Sprintf("p%d", i)]; ok {
+			if err := json.Unmarshal(raw, &search); err != nil {
+				return nil, fmt.Errorf("error decoding page %s: %w", page, err)
+			}
+		}
+
+		summary := PageComments{}
+		if mode != BatchCount {
+			summary.Open = new(int)
+		}
+		if mode == BatchFull {
+			summary.Comments = []Comment{}
+		}
+
+		for _, node := range search.Nodes {
+			if node.Title != pageTitlePrefix+page {
+				continue
+			}
+			summary.Count = node.Comments.TotalCount
+			for _, c := range node.Comments.Nodes {
+				summary.Count += c.Replies.TotalCount
+				if mode != BatchCount && !parseCommentBody(c.Body, page).Metadata.Resolved {
+					*summary.Open++
+				}
+			}
+			if mode == BatchFull {
+				summary.Comments = append(summary.Comments, openComments(node.Comments.Nodes, page)...)
+			}
+			break
+		}
+		summaries[page] = summary
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,357 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const pageTitlePrefix = "Page: "
+
+// PageDiscussion is the discussion holding one page's comments. Comments are
+// in thread order, each top-level comment followed by its replies, and
+// include resolved threads.
+type PageDiscussion struct {
+	ID       string
+	Page     string
+	Labels   []string
+	Comments []Comment
+}
+
+// ListPageDiscussions returns every page discussion in the category. Other
+// discussions that happen to share the category are skipped. Threads with
+// more comments or replies than fit in one response are paged through in
+// full.
+func ListPageDiscussions(client *http.Client, githubToken, owner, repo, categoryID string) ([]PageDiscussion, error) {
+	query := `
+query ListPageDiscussions($owner: String!, $repo: String!, $categoryId: ID!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    discussions(first: 25, after: $after, categoryId: $categoryId) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        id
+        title
+        labels(first: 20) {
+          nodes {
+            name
+          }
+        }
+        comments(first: 50) {
+          pageInfo {
+            hasNextPage
+            endCursor
+          }
+          nodes {
+            id
+            body
+            author {
+              login
+            }
+            createdAt
+            updatedAt
+            reactionGroups {
+              content
+              viewerHasReacted
+              reactors {
+                totalCount
+              }
+            }
+            replies(first: 50) {
+              pageInfo {
+                hasNextPage
+                endCursor
+              }
+              nodes {
+                id
+                body
+                author {
+                  login
+                }
+                createdAt
+                updatedAt
+                reactionGroups {
+                  content
+                  viewerHasReacted
+                  reactors {
+                    totalCount
+                  }
+                }
+                replyTo {
+                  id
+                  author {
+                    login
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+	var discussions []PageDiscussion
+	var after interface{}
+	for {
+		reqBody := GraphQLRequest{
+			Query: query,
+			Variables: map[string]interface{}{
+				"owner":      owner,
+				"repo":       repo,
+				"categoryId": categoryID,
+				"after":      after,
+			},
+		}
+
+		respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("error listing discussions: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+		}
+
+		var result struct {
+			Data struct {
+				Repository struct {
+					Discussions struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							ID     string `json:"id"`
+							Title  string `json:"title"`
+							Labels struct {
+								Nodes []struct {
+									Name string `json:"name"`
+								} `json:"nodes"`
+							} `json:"labels"`
+							Comments struct {
+								PageInfo pageInfo      `json:"pageInfo"`
+								Nodes    []commentNode `json:"nodes"`
+							} `json:"comments"`
+						} `json:"nodes"`
+					} `json:"discussions"`
+				} `json:"repository"`
+			} `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("error decoding discussions: %w", err)
+		}
+		// A partial listing would look like comments had been deleted.
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("error listing discussions: %s", result.Errors[0].Message)
+		}
+
+		for _, node := range result.Data.Repository.Discussions.Nodes {
+			page, ok := strings.CutPrefix(node.Title, pageTitlePrefix)
+			if !ok {
+				continue
+			}
+
+			discussion := PageDiscussion{ID: node.ID, Page: page, Labels: []string{}}
+			for _, label := range node.Labels.Nodes {
+				discussion.Labels = append(discussion.Labels, label.Name)
+			}
+			comments := node.Comments.Nodes
+			if info := node.Comments.PageInfo; info.HasNextPage {
+				more, err := listDiscussionComments(client, githubToken, node.ID, info.EndCursor)
+				if err != nil {
+					return nil, err
+				}
+				comments = append(comments, more...)
+			}
+			for _, c := range comments {
+				discussion.Comments = append(discussion.Comments, c.toComment(page))
+				replies := c.Replies.Nodes
+				if info := c.Replies.PageInfo; info.HasNextPage {
+					more, err := listCommentReplies(client, githubToken, c.ID, info.EndCursor)
+					if err != nil {
+						return nil, err
+					}
+					replies = append(replies, more...)
+				}
+				for _, reply := range replies {
+					discussion.Comments = append(discussion.Comments, reply.toComment(page))
+				}
+			}
+			discussions = append(discussions, discussion)
+		}
+
+		info := result.Data.Repository.Discussions.PageInfo
+		if !info.HasNextPage {
+			return discussions, nil
+		}
+		after = info.EndCursor
+	}
+}
+
+// commentFields is what ListPageDiscussions reads of each comment, for the
+// follow-up queries that page through long threads.
+const commentFields = `
+fragment CommentFields on DiscussionComment {
+  id
+  body
+  author {
+    login
+  }
+  createdAt
+  updatedAt
+  reactionGroups {
+    content
+    viewerHasReacted
+    reactors {
+      totalCount
+    }
+  }
+  replyTo {
+    id
+    author {
+      login
+    }
+  }
+}`
+
+// listDiscussionComments pages through the top-level comments of a
+// discussion after the cursor, with the first replies of each.
+func listDiscussionComments(client *http.Client, githubToken, discussionID, after string) ([]commentNode, error) {
+	query := `
+query ListDiscussionComments($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on Discussion {
+      comments(first: 50, after: $after) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          ...CommentFields
+          replies(first: 50) {
+            pageInfo {
+              hasNextPage
+              endCursor
+            }
+            nodes {
+              ...CommentFields
+            }
+          }
+        }
+      }
+    }
+  }
+}` + commentFields
+
+	var comments []commentNode
+	for {
+		var result struct {
+			Data struct {
+				Node struct {
+					Comments struct {
+						PageInfo pageInfo      `json:"pageInfo"`
+						Nodes    []commentNode `json:"nodes"`
+					} `json:"comments"`
+				} `json:"node"`
+			} `json:"data"`
+		}
+		if err := queryPage(client, githubToken, query, discussionID, after, &result); err != nil {
+			return nil, fmt.Errorf("error listing comments of %s: %w", discussionID, err)
+		}
+
+		comments = append(comments, result.Data.Node.Comments.Nodes...)
+		info := result.Data.Node.Comments.PageInfo
+		if !info.HasNextPage {
+			return comments, nil
+		}
+		after = info.EndCursor
+	}
+}
+
+// listCommentReplies pages through the replies to a comment after the
+// cursor.
+func listCommentReplies(client *http.Client, githubToken, commentID, after string) ([]commentNode, error) {
+	query := `
+query ListCommentReplies($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on DiscussionComment {
+      replies(first: 100, after: $after) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          ...CommentFields
+        }
+      }
+    }
+  }
+}` + commentFields
+
+	var replies []commentNode
+	for {
+		var result struct {
+			Data struct {
+				Node struct {
+					Replies struct {
+						PageInfo pageInfo      `json:"pageInfo"`
+						Nodes    []commentNode `json:"nodes"`
+					} `json:"replies"`
+				} `json:"node"`
+			} `json:"data"`
+		}
+		if err := queryPage(client, githubToken, query, commentID, after, &result); err != nil {
+			return nil, fmt.Errorf("error listing replies to %s: %w", commentID, err)
+		}
+
+		replies = append(replies, result.Data.Node.Replies.Nodes...)
+		info := result.Data.Node.Replies.PageInfo
+		if !info.HasNextPage {
+			return replies, nil
+		}
+		after = info.EndCursor
+	}
+}
+
+// queryPage runs a query taking a node ID and a cursor and decodes the
+// response into result. An empty cursor asks for the first page. GraphQL
+// errors fail the call rather than coming back as an empty page.
+func queryPage(client *http.Client, githubToken, query, id, after string, result any) error {
+	var cursor interface{}
+	if after != "" {
+		cursor = after
+	}
+	respBody, status, err := callGitHubGraphQL(client, githubToken, GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"id":    id,
+			"after": cursor,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+	}
+
+	var errs struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &errs); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(errs.Errors) > 0 {
+		return fmt.Errorf("GitHub API error: %s", errs.Errors[0].Message)
+	}
+	return json.Unmarshal(respBody, result)
+}
@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// ExternalThread is a page's thread from another commenting system, either a
+// giscus discussion or an utterances issue.
+type ExternalThread struct {
+	ID       string
+	Title    string
+	Comments []ExternalComment
+}
+
+type ExternalComment struct {
+	ID        string
+	Author    string
+	Body      string
+	CreatedAt string
+	Replies   []ExternalComment
+}
+
+// ErrThreadTooLong is returned for a thread with more than 100 comments, or
+// a comment with more than 100 replies, rather than importing part of it.
+var ErrThreadTooLong = errors.New("thread has more than 100 comments or replies")
+
+type externalCommentNode struct {
+	ID     string `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	CreatedAt string `json:"createdAt"`
+	Replies   struct {
+		PageInfo pageInfo              `json:"pageInfo"`
+		Nodes    []externalCommentNode `json:"nodes"`
+	} `json:"replies"`
+}
+
+func (n externalCommentNode) toExternal() ExternalComment {
+	c := ExternalComment{ID: n.ID, Author: n.Author.Login, Body: n.Body, CreatedAt: n.CreatedAt}
+	for _, reply := range n.Replies.Nodes {
+		c.Replies = append(c.Replies, reply.toExternal())
+	}
+	return c
+}
+
+// ListDiscussionThreads reads every discussion in a category, the way giscus
+// stores its threads.
+func ListDiscussionThreads(client *http.Client, githubToken, owner, repo, categoryID string) ([]ExternalThread, error) {
+	query := `
+query ListDiscussionThreads($owner: String!, $repo: String!, $categoryId: ID!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    discussions(first: 25, after: $after, categoryId: $categoryId) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        id
+        title
+        comments(first: 100) {
+          pageInfo {
+            hasNextPage
+          }
+          nodes {
+            id
+            body
+            author {
+              login
+            }
+            createdAt
+            replies(first: 100) {
+              pageInfo {
+                hasNextPage
+              }
+              nodes {
+                id
+                body
+                author {
+                  login
+                }
+                createdAt
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+	var threads []ExternalThread
+	var after interface{}
+	for {
+		reqBody := GraphQLRequest{
+			Query: query,
+			Variables: map[string]interface{}{
+				"owner":      owner,
+				"repo":       repo,
+				"categoryId": categoryID,
+				"after":      after,
+			},
+		}
+
+		respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("error listing discussions: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+		}
+
+		var result struct {
+			Data struct {
+				Repository struct {
+					Discussions struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							ID       string `json:"id"`
+							Title    string `json:"title"`
+							Comments struct {
+								PageInfo pageInfo              `json:"pageInfo"`
+								Nodes    []externalCommentNode `json:"nodes"`
+							} `json:"comments"`
+						} `json:"nodes"`
+					} `json:"discussions"`
+				} `json:"repository"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("error decoding discussions: %w", err)
+		}
+
+		for _, node := range result.Data.Repository.Discussions.Nodes {
+			if node.Comments.PageInfo.HasNextPage || slices.ContainsFunc(node.Comments.Nodes, func(c externalCommentNode) bool { return c.Replies.PageInfo.HasNextPage }) {
+				return nil, fmt.Errorf("%w: %q", ErrThreadTooLong, node.Title)
+			}
+			thread := ExternalThread{ID: node.ID, Title: node.Title}
+			for _, c := range node.Comments.Nodes {
+				thread.Comments = append(thread.Comments, c.toExternal())
+			}
+			threads = append(threads, thread)
+		}
+
+		info := result.Data.Repository.Discussions.PageInfo
+		if !info.HasNextPage {
+			return threads, nil
+		}
+		after = info.EndCursor
+	}
+}
+
+// ListIssueThreads reads issues the way utterances stores its threads: one
+// issue per page, with the issue body holding a link back to the page and
+// the comments holding the conversation. Issues can be narrowed to those
+// opened by author and carrying label; empty values don't filter.
+func ListIssueThreads(client *http.Client, githubToken, owner, repo, author, label string) ([]ExternalThread, error) {
+	query := `
+query ListIssueThreads($owner: String!, $repo: String!, $filterBy: IssueFilters, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    issues(first: 25, after: $after, filterBy: $filterBy) {
+      pageInfo {
+        hasNextPage
+        endCursor
+      }
+      nodes {
+        id
+        title
+        comments(first: 100) {
+          pageInfo {
+            hasNextPage
+          }
+          nodes {
+            id
+            body
+            author {
+              login
+            }
+            createdAt
+          }
+        }
+      }
+    }
+  }
+}`
+
+	filterBy := map[string]interface{}{}
+	if author != "" {
+		filterBy["createdBy"] = author
+	}
+	if label != "" {
+		filterBy["labels"] = []string{label}
+	}
+
+	var threads []ExternalThread
+	var after interface{}
+	for {
+		reqBody := GraphQLRequest{
+			Query: query,
+			Variables: map[string]interface{}{
+				"owner":    owner,
+				"repo":     repo,
+				"filterBy": filterBy,
+				"after":    after,
+			},
+		}
+
+		respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("error listing issues: %w", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+		}
+
+		var result struct {
+			Data struct {
+				Repository struct {
+					Issues struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							ID       string `json:"id"`
+							Title    string `json:"title"`
+							Comments struct {
+								PageInfo pageInfo              `json:"pageInfo"`
+								Nodes    []externalCommentNode `json:"nodes"`
+							} `json:"comments"`
+						} `json:"nodes"`
+					} `json:"issues"`
+				} `json:"repository"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("error decoding issues: %w", err)
+		}
+
+		for _, node := range result.Data.Repository.Issues.Nodes {
+			if node.Comments.PageInfo.HasNextPage {
+				return nil, fmt.Errorf("%w: %q", ErrThreadTooLong, node.Title)
+			}
+			thread := ExternalThread{ID: node.ID, Title: node.Title}
+			for _, c := range node.Comments.Nodes {
+				thread.Comments = append(thread.Comments, c.toExternal())
+			}
+			threads = append(threads, thread)
+		}
+
+		info := result.Data.Repository.Issues.PageInfo
+		if !info.HasNextPage {
+			return threads, nil
+		}
+		after = info.EndCursor
+	}
+}
+
+// MoveDiscussion retitles a discussion and moves it to another category.
+func MoveDiscussion(client *http.Client, githubToken, discussionID, title, categoryID string) error {
+	query := `
+mutation MoveDiscussion($id: ID!, $title: String!, $categoryId: ID!) {
+  updateDiscussion(input: { discussionId: $id, title: $title, categoryId: $categoryId }) {
+    discussion { id }
+  }
+}`
+
+	reqBody := GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"id":         discussionID,
+			"title":      title,
+			"categoryId": categoryID,
+		},
+	}
+
+	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	if err != nil {
+		return fmt.Errorf("error updating discussion: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("GitHub API error: %s", result.Errors[0].Message)
+	}
+	return nil
+}
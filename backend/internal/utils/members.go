@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
+)
+
+func IsOrgMember(client *http.Client, githubToken, org, login string) (bool, error) {
+	endpoint := fmt.Sprintf("https://api.github.com/orgs/%s/members/%s", url.PathEscape(org), url.PathEscape(login))
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", githubToken))
+
+	resp, err := metrics.Do(client, "orgMember", req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GitHub API returned %d checking membership of %s in %s", resp.StatusCode, login, org)
+	}
+}
+
+// IsOrgOwner reports whether login is an owner of org. githubToken must be
+// able to read the org's memberships.
+func IsOrgOwner(client *http.Client, githubToken, org, login string) (bool, error) {
+	endpoint := fmt.Sprintf("https://api.github.com/orgs/%s/memberships/%s", url.PathEscape(org), url.PathEscape(login))
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", githubToken))
+
+	resp, err := metrics.Do(client, "orgMembership", req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GitHub API returned %d checking role of %s in %s", resp.StatusCode, login, org)
+	}
+
+	var membership struct {
+		Role  string `json:"role"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&membership); err != nil {
+		return false, fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	return membership.Role == "admin" && membership.State == "active", nil
+}
+
+// MaxMentions is how many people one comment can mention. Each needs a
+// membership check, and anyone past the limit is left as plain text.
+const MaxMentions = 10
+
+// ResolveMentions keeps the logins that isMember says belong to org, once
+// each and at most MaxMentions of them. Mentions of anyone else are left as
+// plain text and never notified.
+func ResolveMentions(org string, logins []string, isMember func(login string) (bool, error)) []string {
+	resolved := []string{}
+	var checked []string
+	for _, login := range logins {
+		if len(checked) == MaxMentions {
+			slog.Info("utils: too many mentions", "org", org, "limit", MaxMentions, "mentions", len(logins))
+			break
+		}
+		if slices.ContainsFunc(checked, func(c string) bool { return strings.EqualFold(c, login) }) {
+			continue
+		}
+		checked = append(checked, login)
+
+		member, err := isMember(login)
+		if err != nil {
+			slog.Warn("utils: resolving mention failed", "org", org, "login", login, "err", err)
+			continue
+		}
+		if member {
+			resolved = append(resolved, login)
+		}
+	}
+	return resolved
+}
+
+// GetPublicEmail returns the email address a user shows on their GitHub
+// profile, or "" if they keep it private.
+func GetPublicEmail(client *http.Client, githubToken, login string) (string, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/users/"+url.PathEscape(login), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", githubToken))
+
+	resp, err := metrics.Do(client, "user", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub API returned %d looking up %s", resp.StatusCode, login)
+	}
+
+	var profile struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	return profile.Email, nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// MetadataVersion is the schema version written by this server. Bump it
+// whenever CommentMetadata changes shape and teach migrateMetadata about it.
+const MetadataVersion = 1
+
+const (
+	metadataOpen  = "<!-- commentasaurus:"
+	metadataClose = "-->"
+	legacyOpen    = "```json"
+	legacyClose   = "```"
+)
+
+// CommentMetadata is the anchor information stored alongside every comment
+// body in the discussion. It is serialized into a hidden HTML comment so it
+// never renders on GitHub and can't collide with anything a user types.
+type CommentMetadata struct {
+	Version       int      `json:"version"`
+	Page          string   `json:"page"`
+	ContextBefore string   `json:"contextBefore"`
+	Text          string   `json:"text"`
+	ContextAfter  string   `json:"contextAfter"`
+	Resolved      bool     `json:"resolved"`
+	ResolvedAt    string   `json:"resolvedAt,omitempty"`
+	Mentions      []string `json:"mentions,omitempty"`
+	// ImportedFrom is the ID of the comment this one was imported or
+	// restored from, so re-running an import or restore skips it.
+	ImportedFrom string `json:"importedFrom,omitempty"`
+}
+
+// parsedBody is a discussion comment split into the user's text and the
+// metadata stored with it. Legacy is set when the metadata came from a
+// pre-versioned ```json block and should be rewritten on the next update.
+type parsedBody struct {
+	Comment  string
+	Metadata CommentMetadata
+	Legacy   bool
+}
+
+func encodeCommentBody(comment string, meta CommentMetadata) string {
+	meta.Version = MetadataVersion
+	// json.Marshal escapes '>' so user text can never close the marker early.
+	data, _ := json.Marshal(meta)
+	return fmt.Sprintf("%s\n\n%s%s%s", strings.TrimSpace(comment), metadataOpen, data, metadataClose)
+}
+
+func parseCommentBody(body, page string) parsedBody {
+	out := parsedBody{
+		Comment:  strings.TrimSpace(body),
+		Metadata: CommentMetadata{Version: MetadataVersion, Page: page},
+	}
+
+	if openIdx := strings.LastIndex(body, metadataOpen); openIdx != -1 {
+		afterOpen := body[openIdx+len(metadataOpen):]
+		closeRelIdx := strings.Index(afterOpen, metadataClose)
+		if closeRelIdx != -1 {
+			var meta CommentMetadata
+			if err := json.Unmarshal([]byte(strings.TrimSpace(afterOpen[:closeRelIdx])), &meta); err != nil {
+				slog.Warn("utils: parsing comment metadata failed", "page", page, "err", err)
+				return out
+			}
+			out.Metadata = migrateMetadata(meta, page)
+			out.Comment = strings.TrimSpace(body[:openIdx])
+			return out
+		}
+	}
+
+	if meta, idx, ok := parseLegacyBlock(body); ok {
+		out.Metadata = migrateMetadata(meta, page)
+		out.Comment = strings.TrimSpace(body[:idx])
+		out.Legacy = true
+	}
+
+	return out
+}
+
+// parseLegacyBlock reads the map[string]string ```json block written before
+// metadata was versioned. Only a block that closes the body counts, so a
+// snippet the user pasted earlier in their comment is left alone.
+func parseLegacyBlock(body string) (CommentMetadata, int, bool) {
+	trimmed := strings.TrimRightFunc(body, isSpace)
+	if !strings.HasSuffix(trimmed, legacyClose) {
+		return CommentMetadata{}, 0, false
+	}
+	inner := trimmed[:len(trimmed)-len(legacyClose)]
+
+	openIdx := strings.LastIndex(inner, legacyOpen)
+	if openIdx == -1 {
+		return CommentMetadata{}, 0, false
+	}
+
+	var legacy map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(inner[openIdx+len(legacyOpen):])), &legacy); err != nil {
+		return CommentMetadata{}, 0, false
+	}
+	if _, ok := legacy["page"]; !ok {
+		return CommentMetadata{}, 0, false
+	}
+
+	return CommentMetadata{
+		Version:       0,
+		Page:          legacy["page"],
+		ContextBefore: legacy["contextBefore"],
+		Text:          legacy["text"],
+		ContextAfter:  legacy["contextAfter"],
+		Resolved:      legacy["resolved"] == "true",
+	}, openIdx, true
+}
+
+func migrateMetadata(meta CommentMetadata, page string) CommentMetadata {
+	if meta.Version > MetadataVersion {
+		slog.Warn("utils: comment metadata is newer than supported", "version", meta.Version, "supported", MetadataVersion)
+	}
+	if meta.Page == "" {
+		meta.Page = page
+	}
+	meta.Version = MetadataVersion
+	return meta
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\r' || r == '\t'
+}
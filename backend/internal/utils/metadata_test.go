@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommentBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want parsedBody
+	}{
+		{
+			name: "marker",
+			body: "Looks wrong\n\n<!-- commentasaurus:{\"version\":1,\"page\":\"/docs/a\",\"text\":\"foo\",\"resolved\":true} -->",
+			want: parsedBody{
+				Comment:  "Looks wrong",
+				Metadata: CommentMetadata{Version: 1, Page: "/docs/a", Text: "foo", Resolved: true},
+			},
+		},
+		{
+			name: "marker without page",
+			body: "Hi\n\n<!-- commentasaurus:{\"version\":1,\"text\":\"foo\"}-->",
+			want: parsedBody{
+				Comment:  "Hi",
+				Metadata: CommentMetadata{Version: 1, Page: "/fallback", Text: "foo"},
+			},
+		},
+		{
+			name: "legacy block",
+			body: "Typo here\n\n```json\n{\"page\":\"/docs/a\",\"contextBefore\":\"a \",\"text\":\"teh\",\"contextAfter\":\" b\",\"resolved\":\"true\"}\n```\n",
+			want: parsedBody{
+				Comment:  "Typo here",
+				Metadata: CommentMetadata{Version: 1, Page: "/docs/a", ContextBefore: "a ", Text: "teh", ContextAfter: " b", Resolved: true},
+				Legacy:   true,
+			},
+		},
+		{
+			name: "marker wins over pasted json",
+			body: "See:\n```json\n{\"page\":\"/elsewhere\"}\n```\n\n<!-- commentasaurus:{\"version\":1,\"page\":\"/docs/a\"}-->",
+			want: parsedBody{
+				Comment:  "See:\n```json\n{\"page\":\"/elsewhere\"}\n```",
+				Metadata: CommentMetadata{Version: 1, Page: "/docs/a"},
+			},
+		},
+		{
+			name: "pasted json without page",
+			body: "Try:\n```json\n{\"a\":\"b\"}\n```",
+			want: parsedBody{
+				Comment:  "Try:\n```json\n{\"a\":\"b\"}\n```",
+				Metadata: CommentMetadata{Version: 1, Page: "/fallback"},
+			},
+		},
+		{
+			name: "json block not at the end",
+			body: "```json\n{\"page\":\"/docs/a\"}\n```\nmore text",
+			want: parsedBody{
+				Comment:  "```json\n{\"page\":\"/docs/a\"}\n```\nmore text",
+				Metadata: CommentMetadata{Version: 1, Page: "/fallback"},
+			},
+		},
+		{
+			name: "broken marker",
+			body: "Hi\n\n<!-- commentasaurus:{not json}-->",
+			want: parsedBody{
+				Comment:  "Hi\n\n<!-- commentasaurus:{not json}-->",
+				Metadata: CommentMetadata{Version: 1, Page: "/fallback"},
+			},
+		},
+		{
+			name: "plain",
+			body: "  just text \n",
+			want: parsedBody{
+				Comment:  "just text",
+				Metadata: CommentMetadata{Version: 1, Page: "/fallback"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseCommentBody(tt.body, "/fallback")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCommentBody() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeCommentBodyRoundTrip(t *testing.T) {
+	meta := CommentMetadata{Page: "/docs/a", Text: "a --> b", Mentions: []string{"octocat"}}
+	got := parseCommentBody(encodeCommentBody("Hello -->", meta), "/other")
+
+	meta.Version = MetadataVersion
+	want := parsedBody{Comment: "Hello -->", Metadata: meta}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMigrateMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		in   CommentMetadata
+		want CommentMetadata
+	}{
+		{"legacy", CommentMetadata{Version: 0, Text: "x"}, CommentMetadata{Version: MetadataVersion, Page: "/p", Text: "x"}},
+		{"keeps page", CommentMetadata{Version: 1, Page: "/q"}, CommentMetadata{Version: MetadataVersion, Page: "/q"}},
+		{"newer", CommentMetadata{Version: MetadataVersion + 1, Page: "/q"}, CommentMetadata{Version: MetadataVersion, Page: "/q"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := migrateMetadata(tt.in, "/p"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("migrateMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
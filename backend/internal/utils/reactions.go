@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var reactionContents = map[string]bool{
+	"THUMBS_UP":   true,
+	"THUMBS_DOWN": true,
+	"LAUGH":       true,
+	"HOORAY":      true,
+	"CONFUSED":    true,
+	"HEART":       true,
+	"ROCKET":      true,
+	"EYES":        true,
+}
+
+// NormalizeReaction maps user input such as "thumbs_up" or "heart" to a
+// GitHub ReactionContent value.
+func NormalizeReaction(content string) (string, bool) {
+	normalized := strings.ToUpper(strings.TrimSpace(content))
+	normalized = strings.ReplaceAll(normalized, "-", "_")
+	return normalized, reactionContents[normalized]
+}
+
+func AddReaction(client *http.Client, githubToken, commentID, content string) ([]Reaction, error) {
+	query := `
+mutation AddReaction($subjectId: ID!, $content: ReactionContent!) {
+  addReaction(input: { subjectId: $subjectId, content: $content }) {
+    subject {
+      reactionGroups {
+        content
+        viewerHasReacted
+        reactors {
+          totalCount
+        }
+      }
+    }
+  }
+}`
+
+	var result struct {
+		Data struct {
+			AddReaction struct {
+				Subject struct {
+					ReactionGroups []reactionGroupNode `json:"reactionGroups"`
+				} `json:"subject"`
+			} `json:"addReaction"`
+		} `json:"data"`
+	}
+
+	if err := reactionMutation(client, githubToken, query, commentID, content, &result); err != nil {
+		return nil, err
+	}
+
+	return toReactions(result.Data.AddReaction.Subject.ReactionGroups), nil
+}
+
+func RemoveReaction(client *http.Client, githubToken, commentID, content string) ([]Reaction, error) {
+	query := `
+mutation RemoveReaction($subjectId: ID!, $content: ReactionContent!) {
+  removeReaction(input: { subjectId: $subjectId, content: $content }) {
+    subject {
+      reactionGroups {
+        content
+        viewerHasReacted
+        reactors {
+          totalCount
+        }
+      }
+    }
+  }
+}`
+
+	var result struct {
+		Data struct {
+			RemoveReaction struct {
+				Subject struct {
+					ReactionGroups []reactionGroupNode `json:"reactionGroups"`
+				} `json:"subject"`
+			} `json:"removeReaction"`
+		} `json:"data"`
+	}
+
+	if err := reactionMutation(client, githubToken, query, commentID, content, &result); err != nil {
+		return nil, err
+	}
+
+	return toReactions(result.Data.RemoveReaction.Subject.ReactionGroups), nil
+}
+
+func reactionMutation(client *http.Client, githubToken, query, commentID, content string, result any) error {
+	reqBody := GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"subjectId": commentID,
+			"content":   content,
+		},
+	}
+
+	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	if err != nil {
+		return fmt.Errorf("Error updating reaction: %v", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+	}
+
+	var errResult struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &errResult); err == nil && len(errResult.Errors) > 0 {
+		return fmt.Errorf("GitHub API error: %s", errResult.Errors[0].Message)
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	return nil
+}
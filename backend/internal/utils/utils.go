@@ -6,22 +6,122 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/markdown"
+	"github.com/NicholasRucinski/commentasaurus/internal/metrics"
 )
 
 type Comment struct {
-	ID            string `json:"id"`
-	Page          string `json:"page"`
-	BeforeContext string `json:"contextBefore"`
-	Text          string `json:"text"`
-	AfterContext  string `json:"contextAfter"`
-	Comment       string `json:"comment"`
-	User          string `json:"user,omitempty"`
-	Resolved      bool   `json:"resolved"`
-	CreatedAt     string `json:"createdAt"`
+	ID            string     `json:"id"`
+	Page          string     `json:"page"`
+	BeforeContext string     `json:"contextBefore"`
+	Text          string     `json:"text"`
+	AfterContext  string     `json:"contextAfter"`
+	Comment       string     `json:"comment"`
+	Mentions      []string   `json:"mentions,omitempty"`
+	BodyHTML      string     `json:"bodyHTML"`
+	User          string     `json:"user,omitempty"`
+	Resolved      bool       `json:"resolved"`
+	ResolvedAt    string     `json:"resolvedAt,omitempty"`
+	CreatedAt     string     `json:"createdAt"`
+	UpdatedAt     string     `json:"updatedAt"`
+	Reactions     []Reaction `json:"reactions"`
+	ReplyTo       string     `json:"replyTo,omitempty"`
+	ReplyToUser   string     `json:"replyToUser,omitempty"`
+	ImportedFrom  string     `json:"importedFrom,omitempty"`
+}
+
+type Reaction struct {
+	Content          string `json:"content"`
+	Count            int    `json:"count"`
+	ViewerHasReacted bool   `json:"viewerHasReacted"`
+}
+
+// NewComment builds the API representation of a discussion comment, splitting
+// the stored metadata back out of the body.
+func NewComment(id, body, author, createdAt, updatedAt, page string) Comment {
+	parsed := parseCommentBody(body, page)
+	return Comment{
+		ID:            id,
+		Page:          page,
+		BeforeContext: parsed.Metadata.ContextBefore,
+		Text:          parsed.Metadata.Text,
+		AfterContext:  parsed.Metadata.ContextAfter,
+		Comment:       parsed.Comment,
+		BodyHTML:      markdown.Render(id, updatedAt, parsed.Comment),
+		Mentions:      parsed.Metadata.Mentions,
+		ImportedFrom:  parsed.Metadata.ImportedFrom,
+		User:          author,
+		Resolved:      parsed.Metadata.Resolved,
+		ResolvedAt:    parsed.Metadata.ResolvedAt,
+		CreatedAt:     createdAt,
+		UpdatedAt:     updatedAt,
+		Reactions:     []Reaction{},
+	}
+}
+
+type commentNode struct {
+	ID     string `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	CreatedAt      string              `json:"createdAt"`
+	UpdatedAt      string              `json:"updatedAt"`
+	ReactionGroups []reactionGroupNode `json:"reactionGroups"`
+	ReplyTo        *struct {
+		ID     string `json:"id"`
+		Author struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"replyTo"`
+	Replies struct {
+		TotalCount int           `json:"totalCount"`
+		PageInfo   pageInfo      `json:"pageInfo"`
+		Nodes      []commentNode `json:"nodes"`
+	} `json:"replies"`
+}
+
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type reactionGroupNode struct {
+	Content          string `json:"content"`
+	ViewerHasReacted bool   `json:"viewerHasReacted"`
+	Reactors         struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"reactors"`
+}
+
+func (n commentNode) toComment(page string) Comment {
+	comment := NewComment(n.ID, n.Body, n.Author.Login, n.CreatedAt, n.UpdatedAt, page)
+	comment.Reactions = toReactions(n.ReactionGroups)
+	if n.ReplyTo != nil {
+		comment.ReplyTo = n.ReplyTo.ID
+		comment.ReplyToUser = n.ReplyTo.Author.Login
+	}
+	return comment
+}
+
+func toReactions(groups []reactionGroupNode) []Reaction {
+	reactions := []Reaction{}
+	for _, group := range groups {
+		if group.Reactors.TotalCount == 0 && !group.ViewerHasReacted {
+			continue
+		}
+		reactions = append(reactions, Reaction{
+			Content:          group.Content,
+			Count:            group.Reactors.TotalCount,
+			ViewerHasReacted: group.ViewerHasReacted,
+		})
+	}
+	return reactions
 }
 
 type GraphQLRequest struct {
@@ -73,88 +173,54 @@ func GetRepositoryID(client *http.Client, githubToken, owner, repo string) (stri
 }
 
 func GetComments(client *http.Client, githubToken, discussionID, page string) ([]Comment, error) {
-	query := `
-query GetDiscussionComments($discussionId: ID!) {
-  node(id: $discussionId) {
-    ... on Discussion {
-      comments(first: 50) {
-        nodes {
-          id
-          body
-          author {
-          	login
-          }
-          createdAt
-        }
-      }
-    }
-  }
-}`
-
-	reqBody := GraphQLRequest{
-		Query: query,
-		Variables: map[string]interface{}{
-			"discussionId": discussionID,
-		},
-	}
-
-	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	nodes, err := listDiscussionComments(client, githubToken, discussionID, "")
 	if err != nil {
-		return nil, fmt.Errorf("Error fetching comments: %v", err)
-	}
-	if status != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
-	}
-
-	// log.Printf("GitHub Response: %s\n", string(respBody))
-	var result struct {
-		Data struct {
-			Node struct {
-				Comments struct {
-					Nodes []struct {
-						ID     string `json:"id"`
-						Body   string `json:"body"`
-						Author struct {
-							Login string `json:"login"`
-						} `json:"author"`
-						CreatedAt string `json:"createdAt"`
-					} `json:"nodes"`
-				} `json:"comments"`
-			} `json:"node"`
-		} `json:"data"`
-	}
-
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("Error decoding JSON: %v", err)
+		return nil, err
+	}
+	for i, node := range nodes {
+		if info := node.Replies.PageInfo; info.HasNextPage && !node.toComment(page).Resolved {
+			more, err := listCommentReplies(client, githubToken, node.ID, info.EndCursor)
+			if err != nil {
+				return nil, err
+			}
+			nodes[i].Replies.Nodes = append(node.Replies.Nodes, more...)
+		}
 	}
+	return openComments(nodes, page), nil
+}
 
+// openComments flattens unresolved threads, each top-level comment followed
+// by its replies.
+func openComments(nodes []commentNode, page string) []Comment {
 	var comments []Comment
-	for _, node := range result.Data.Node.Comments.Nodes {
-		parsed := parseCommentBody(node.Body, page)
-		resolved, err := strconv.ParseBool(parsed["resolved"])
-		if err != nil {
-			log.Println("Failed to parse resolved to bool")
-			resolved = false
+	for _, node := range nodes {
+		comment := node.toComment(page)
+		if comment.Resolved {
+			continue
 		}
-		if !resolved {
-			comments = append(comments, Comment{
-				ID:            node.ID,
-				Page:          page,
-				BeforeContext: parsed["contextBefore"],
-				Text:          parsed["text"],
-				AfterContext:  parsed["contextAfter"],
-				Comment:       parsed["comment"],
-				User:          node.Author.Login,
-				Resolved:      resolved,
-				CreatedAt:     node.CreatedAt,
-			})
+		comments = append(comments, comment)
+		for _, reply := range node.Replies.Nodes {
+			comments = append(comments, reply.toComment(page))
 		}
 	}
+	return comments
+}
+
+func UpdateComment(client *http.Client, githubToken, id, page string) (Comment, error) {
+	return ModifyComment(client, githubToken, id, page, MarkResolved)
+}
 
-	return comments, nil
+// MarkResolved is the ModifyComment callback UpdateComment uses.
+func MarkResolved(comment *string, meta *CommentMetadata) {
+	if !meta.Resolved {
+		meta.ResolvedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	meta.Resolved = true
 }
 
-func UpdateComment(client *http.Client, githubToken, id, page string) error {
+// ModifyComment reads a comment, lets modify change its text and metadata and
+// writes it back. Legacy metadata is upgraded as part of the write.
+func ModifyComment(client *http.Client, githubToken, id, page string, modify func(comment *string, meta *CommentMetadata)) (Comment, error) {
 	query := `
 	query GetComment($id: ID!) {
 	  node(id: $id) {
@@ -174,12 +240,12 @@ func UpdateComment(client *http.Client, githubToken, id, page string) error {
 
 	respBody, status, err := callGitHubGraphQL(client, githubToken, getReq)
 	if err != nil {
-		log.Printf("Error fetching comment: %v", err)
-		return fmt.Errorf("Error fetching comment: %v", err)
+		slog.Error("utils: fetching comment failed", "comment", id, "err", err)
+		return Comment{}, fmt.Errorf("Error fetching comment: %v", err)
 	}
 	if status != http.StatusOK {
-		log.Printf("GitHub API returned %d: %s", status, string(respBody))
-		return fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+		slog.Warn("utils: fetching comment failed", "comment", id, "status", status, "body", string(respBody))
+		return Comment{}, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
 	}
 
 	var result struct {
@@ -191,25 +257,19 @@ func UpdateComment(client *http.Client, githubToken, id, page string) error {
 		} `json:"data"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		log.Printf("Error decoding response: %v", err)
-		return fmt.Errorf("Error decoding response: %v", err)
+		slog.Error("utils: decoding comment failed", "comment", id, "err", err)
+		return Comment{}, fmt.Errorf("Error decoding response: %v", err)
 	}
 
 	body := result.Data.Node.Body
 
 	parsed := parseCommentBody(body, page)
+	if parsed.Legacy {
+		slog.Info("utils: migrating legacy metadata", "comment", id)
+	}
 
-	updatedBody := fmt.Sprintf(
-		"%s\n\n```json\n%s\n```",
-		parsed["comment"],
-		toJSONString(map[string]string{
-			"contextBefore": parsed["contextBefore"],
-			"text":          parsed["text"],
-			"contextAfter":  parsed["contextAfter"],
-			"page":          parsed["page"],
-			"resolved":      "true",
-		}),
-	)
+	modify(&parsed.Comment, &parsed.Metadata)
+	updatedBody := encodeCommentBody(parsed.Comment, parsed.Metadata)
 
 	updateQuery := `
 	mutation UpdateComment($id: ID!, $body: String!) {
@@ -217,6 +277,11 @@ func UpdateComment(client *http.Client, githubToken, id, page string) error {
 	    comment {
 	      id
 	      body
+	      author {
+	        login
+	      }
+	      createdAt
+	      updatedAt
 	    }
 	  }
 	}`
@@ -231,14 +296,27 @@ func UpdateComment(client *http.Client, githubToken, id, page string) error {
 
 	updateResp, status, err := callGitHubGraphQL(client, githubToken, updateReq)
 	if err != nil {
-		log.Printf("Error updating comment: %v", err)
-		return fmt.Errorf("Error updating comment: %v", err)
+		slog.Error("utils: updating comment failed", "comment", id, "err", err)
+		return Comment{}, fmt.Errorf("Error updating comment: %v", err)
 	}
 	if status != http.StatusOK {
-		log.Printf("GitHub API returned %d: %s", status, string(updateResp))
-		return fmt.Errorf("GitHub API returned %d: %s", status, string(updateResp))
+		slog.Warn("utils: updating comment failed", "comment", id, "status", status, "body", string(updateResp))
+		return Comment{}, fmt.Errorf("GitHub API returned %d: %s", status, string(updateResp))
 	}
-	return nil
+
+	var updateResult struct {
+		Data struct {
+			UpdateDiscussionComment struct {
+				Comment commentNode `json:"comment"`
+			} `json:"updateDiscussionComment"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(updateResp, &updateResult); err != nil {
+		slog.Error("utils: decoding updated comment failed", "comment", id, "err", err)
+		return Comment{}, fmt.Errorf("Error decoding response: %v", err)
+	}
+
+	return updateResult.Data.UpdateDiscussionComment.Comment.toComment(page), nil
 }
 
 func FindOrCreateCommentsCategory(client *http.Client, token, owner, repo, categoryName string) (string, error) {
@@ -286,7 +364,7 @@ func FindOrCreateCommentsCategory(client *http.Client, token, owner, repo, categ
 
 	for _, cat := range result.Data.Repository.DiscussionCategories.Nodes {
 		if cat.Name == categoryName {
-			log.Printf("Found existing discussion category '%s': %s", categoryName, cat.ID)
+			slog.Debug("utils: found discussion category", "category", categoryName, "id", cat.ID)
 			return cat.ID, nil
 		}
 	}
@@ -295,7 +373,7 @@ func FindOrCreateCommentsCategory(client *http.Client, token, owner, repo, categ
 }
 
 func FindOrCreateDiscussion(client *http.Client, token, owner, repo, page, categoryId, repoId string) (string, error) {
-	log.Printf("Looking for discussion for page: %s", page)
+	slog.Debug("utils: looking for discussion", "page", page)
 
 	findQuery := `
 query FindDiscussion($query: String!) {
@@ -340,12 +418,12 @@ query FindDiscussion($query: String!) {
 
 	for _, node := range findResult.Data.Search.Nodes {
 		if node.Title == fmt.Sprintf("Page: %s", page) {
-			log.Printf("Found existing discussion for %s: %s", page, node.ID)
+			slog.Debug("utils: found discussion", "page", page, "id", node.ID)
 			return node.ID, nil
 		}
 	}
 
-	log.Printf("No existing discussion found for %s — creating new one", page)
+	slog.Info("utils: no discussion found, creating one", "page", page)
 
 	createQuery := `
 mutation CreateDiscussion($repoId: ID!, $title: String!, $body: String!, $categoryId: ID!) {
@@ -389,62 +467,162 @@ mutation CreateDiscussion($repoId: ID!, $title: String!, $body: String!, $catego
 		return "", fmt.Errorf("error unmarshalling create result: %w", err)
 	}
 
-	log.Printf("Created new discussion for %s: %s", page, createResult.Data.CreateDiscussion.Discussion.ID)
+	slog.Info("utils: created discussion", "page", page, "id", createResult.Data.CreateDiscussion.Discussion.ID)
 	return createResult.Data.CreateDiscussion.Discussion.ID, nil
 }
 
-func CreateComment(client *http.Client, discussionID, githubToken, comment, contextBefore, text, contextAfter, page string) (string, error) {
-	commentBody := fmt.Sprintf(
-		"%s\n\n```json\n%s\n```",
-		comment,
-		toJSONString(map[string]string{
-			"contextBefore": contextBefore,
-			"text":          text,
-			"contextAfter":  contextAfter,
-			"page":          page,
-			"resolved":      "false",
-		}),
-	)
+// CreateComment adds a comment to the discussion. When replyTo is set the
+// comment is threaded under that comment instead of starting a new one.
+func CreateComment(client *http.Client, discussionID, githubToken, comment string, meta CommentMetadata, replyTo string) (Comment, error) {
+	commentBody := encodeCommentBody(comment, meta)
 
 	graphQLQuery := `
-mutation AddDiscussionComment($discussionId: ID!, $body: String!) {
-  addDiscussionComment(input: { discussionId: $discussionId, body: $body }) {
-    comment { id body }
+mutation AddDiscussionComment($discussionId: ID!, $body: String!, $replyToId: ID) {
+  addDiscussionComment(input: { discussionId: $discussionId, body: $body, replyToId: $replyToId }) {
+    comment { id body author { login } createdAt updatedAt replyTo { id author { login } } }
   }
 }`
 
+	var replyToID interface{}
+	if replyTo != "" {
+		replyToID = replyTo
+	}
+
 	reqBody := GraphQLRequest{
 		Query: graphQLQuery,
 		Variables: map[string]interface{}{
 			"discussionId": discussionID,
 			"body":         commentBody,
+			"replyToId":    replyToID,
 		},
 	}
 
 	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
 	if err != nil {
-		return "", fmt.Errorf(fmt.Sprintf("Error adding comment: %v", err))
+		return Comment{}, fmt.Errorf("Error adding comment: %v", err)
 	}
 
 	if status != http.StatusOK {
-		return "", fmt.Errorf(fmt.Sprintf("GitHub API returned %d: %s", status, string(respBody)))
+		return Comment{}, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
 	}
 
 	var result struct {
 		Data struct {
 			AddDiscussionComment struct {
-				Comment struct {
-					ID string `json:"id"`
-				} `json:"comment"`
+				Comment commentNode `json:"comment"`
 			} `json:"addDiscussionComment"`
 		} `json:"data"`
 	}
 
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", errors.New(fmt.Sprintf("Error decoding JSON: %v", err))
+		return Comment{}, errors.New(fmt.Sprintf("Error decoding JSON: %v", err))
+	}
+
+	return result.Data.AddDiscussionComment.Comment.toComment(meta.Page), nil
+}
+
+// CommentLocation is where a discussion comment lives.
+type CommentLocation struct {
+	Owner string
+	Repo  string
+	Page  string
+}
+
+// LocateComment finds the repo and page of a comment from its ID. Page is
+// empty when the discussion isn't one of ours.
+func LocateComment(client *http.Client, githubToken, id string) (CommentLocation, error) {
+	query := `
+query LocateComment($id: ID!) {
+  node(id: $id) {
+    ... on DiscussionComment {
+      discussion {
+        title
+        repository { name owner { login } }
+      }
+    }
+  }
+}`
+
+	reqBody := GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"id": id,
+		},
+	}
+
+	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	if err != nil {
+		return CommentLocation{}, fmt.Errorf("Error fetching comment: %v", err)
+	}
+	if status != http.StatusOK {
+		return CommentLocation{}, fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
+	}
+
+	var result struct {
+		Data struct {
+			Node *struct {
+				Discussion *struct {
+					Title      string `json:"title"`
+					Repository struct {
+						Name  string `json:"name"`
+						Owner struct {
+							Login string `json:"login"`
+						} `json:"owner"`
+					} `json:"repository"`
+				} `json:"discussion"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return CommentLocation{}, fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	if result.Data.Node == nil || result.Data.Node.Discussion == nil {
+		return CommentLocation{}, fmt.Errorf("comment %s not found", id)
+	}
+
+	d := result.Data.Node.Discussion
+	loc := CommentLocation{Owner: d.Repository.Owner.Login, Repo: d.Repository.Name}
+	if page, ok := strings.CutPrefix(d.Title, pageTitlePrefix); ok {
+		loc.Page = page
+	}
+	return loc, nil
+}
+
+func DeleteComment(client *http.Client, githubToken, id string) error {
+	query := `
+mutation DeleteComment($id: ID!) {
+  deleteDiscussionComment(input: { id: $id }) {
+    comment { id }
+  }
+}`
+
+	reqBody := GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"id": id,
+		},
+	}
+
+	respBody, status, err := callGitHubGraphQL(client, githubToken, reqBody)
+	if err != nil {
+		return fmt.Errorf("Error deleting comment: %v", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %d: %s", status, string(respBody))
 	}
 
-	return result.Data.AddDiscussionComment.Comment.ID, nil
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("GitHub API error: %s", result.Errors[0].Message)
+	}
+	return nil
 }
 
 func callGitHubGraphQL(client *http.Client, token string, body GraphQLRequest) ([]byte, int, error) {
@@ -457,48 +635,20 @@ func callGitHubGraphQL(client *http.Client, token string, body GraphQLRequest) (
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", token))
 
+	start := time.Now()
+	operation := metrics.GraphQLOperation(body.Query)
 	resp, err := client.Do(req)
+	kind := metrics.ErrorKind(resp, err)
 	if err != nil {
+		metrics.GitHubCall(operation, start, kind)
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
-	return respBody, resp.StatusCode, nil
-}
-
-func toJSONString(v interface{}) string {
-	data, _ := json.MarshalIndent(v, "", "  ")
-	return string(data)
-}
-
-func parseCommentBody(body, page string) map[string]string {
-	out := map[string]string{"page": page, "comment": strings.TrimSpace(body)}
-
-	startMarker := "```json"
-	openIdx := strings.Index(body, startMarker)
-	if openIdx == -1 {
-		return out
+	if kind == "ok" {
+		kind = metrics.GraphQLErrorKind(respBody)
 	}
-
-	afterOpen := body[openIdx+len(startMarker):]
-	closeRelIdx := strings.Index(afterOpen, "```")
-	if closeRelIdx == -1 {
-		return out
-	}
-
-	jsonInner := strings.TrimSpace(afterOpen[:closeRelIdx])
-
-	var meta map[string]string
-	if err := json.Unmarshal([]byte(jsonInner), &meta); err != nil {
-		log.Printf("parseCommentBody: failed to unmarshal json block: %v", err)
-	} else {
-		for k, v := range meta {
-			out[k] = v
-		}
-	}
-
-	out["comment"] = strings.TrimSpace(body[:openIdx])
-
-	return out
+	metrics.GitHubCall(operation, start, kind)
+	return respBody, resp.StatusCode, nil
 }
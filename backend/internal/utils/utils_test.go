@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestGetCommentsPagesThroughThreads(t *testing.T) {
+	// Two pages of comments. c1's replies run onto a second page, and c3 is
+	// resolved, so its thread is left out.
+	pages := map[string]string{
+		"ListDiscussionComments D1 <nil>": `{"data":{"node":{"comments":{
+			"pageInfo":{"hasNextPage":true,"endCursor":"comments-2"},
+			"nodes":[{"id":"c1","body":"first","replies":{
+				"pageInfo":{"hasNextPage":true,"endCursor":"replies-2"},
+				"nodes":[{"id":"r1","body":"reply one"}]}}]}}}}`,
+		"ListDiscussionComments D1 comments-2": `{"data":{"node":{"comments":{
+			"pageInfo":{"hasNextPage":false},
+			"nodes":[
+				{"id":"c2","body":"second","replies":{"nodes":[]}},
+				{"id":"c3","body":"done\n\n<!-- commentasaurus:{\"version\":1,\"resolved\":true} -->","replies":{
+					"pageInfo":{"hasNextPage":true,"endCursor":"never-read"},"nodes":[]}}]}}}}`,
+		"ListCommentReplies c1 replies-2": `{"data":{"node":{"replies":{
+			"pageInfo":{"hasNextPage":false},
+			"nodes":[{"id":"r2","body":"reply two","replyTo":{"id":"c1"}}]}}}}`,
+	}
+
+	var asked []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body GraphQLRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		name := strings.Fields(strings.TrimSpace(body.Query))[1]
+		name = name[:strings.Index(name, "(")]
+		key := name + " " + body.Variables["id"].(string) + " " + fmtCursor(body.Variables["after"])
+		asked = append(asked, key)
+
+		resp, ok := pages[key]
+		if !ok {
+			resp = `{"errors":[{"message":"unexpected query ` + key + `"}]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(resp))}, nil
+	})}
+
+	comments, err := GetComments(client, "token", "D1", "/docs/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	if want := []string{"c1", "r1", "r2", "c2"}; !slices.Equal(ids, want) {
+		t.Errorf("GetComments IDs = %v, want %v (asked %v)", ids, want, asked)
+	}
+	if len(asked) != len(pages) {
+		t.Errorf("made %d queries, want %d: %v", len(asked), len(pages), asked)
+	}
+}
+
+func TestGetCommentsFailsOnPartialThread(t *testing.T) {
+	calls := 0
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		resp := `{"data":{"node":{"comments":{"pageInfo":{"hasNextPage":true,"endCursor":"next"},"nodes":[{"id":"c1"}]}}}}`
+		if calls > 1 {
+			resp = `{"errors":[{"message":"secondary rate limit"}]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(resp))}, nil
+	})}
+
+	// Half a thread would read as comments having been deleted.
+	if comments, err := GetComments(client, "token", "D1", "/docs/a"); err == nil {
+		t.Errorf("GetComments = %v, want the rate limit error", comments)
+	}
+}
+
+func fmtCursor(after any) string {
+	if after == nil {
+		return "<nil>"
+	}
+	return after.(string)
+}
+
+func TestResolveMentions(t *testing.T) {
+	var checked []string
+	isMember := func(login string) (bool, error) {
+		checked = append(checked, login)
+		switch login {
+		case "outsider":
+			return false, nil
+		case "flaky":
+			return false, errors.New("rate limited")
+		}
+		return true, nil
+	}
+
+	logins := []string{"octocat", "OctoCat", "outsider", "flaky", "octocat"}
+	for i := range 20 {
+		logins = append(logins, fmt.Sprintf("user%d", i))
+	}
+
+	got := ResolveMentions("acme", logins, isMember)
+	want := []string{"octocat", "user0", "user1", "user2", "user3", "user4", "user5", "user6"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ResolveMentions = %v, want %v", got, want)
+	}
+	if len(checked) != MaxMentions {
+		t.Errorf("checked %d logins, want at most %d: %v", len(checked), MaxMentions, checked)
+	}
+}
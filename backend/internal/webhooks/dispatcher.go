@@ -0,0 +1,196 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/events"
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+	"github.com/NicholasRucinski/commentasaurus/internal/utils"
+)
+
+const (
+	maxAttempts  = 8
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+	pollInterval = 5 * time.Second
+	batchSize    = 20
+)
+
+// EventNames are the lifecycle events a webhook can subscribe to.
+var EventNames = map[events.Type]string{
+	events.Created:  "comment.created",
+	events.Edited:   "comment.edited",
+	events.Resolved: "comment.resolved",
+	events.Deleted:  "comment.deleted",
+}
+
+type Payload struct {
+	Event     string        `json:"event"`
+	Timestamp time.Time     `json:"timestamp"`
+	Org       string        `json:"org"`
+	Repo      string        `json:"repo"`
+	Page      string        `json:"page"`
+	Actor     string        `json:"actor,omitempty"`
+	Comment   utils.Comment `json:"comment"`
+}
+
+// Dispatcher queues a delivery for every matching webhook when a comment
+// event is published and works the queue in the background, retrying with
+// exponential backoff until a delivery succeeds or is dead-lettered.
+type Dispatcher struct {
+	Store  *store.Store
+	Client *http.Client
+}
+
+func (d *Dispatcher) Run(ctx context.Context, broker *events.Broker) {
+	if d.Client == nil {
+		d.Client = newClient()
+	}
+	go d.work(ctx)
+	broker.Listen(ctx, d.enqueue)
+}
+
+func (d *Dispatcher) enqueue(e events.Event) {
+	name, ok := EventNames[e.Type]
+	if !ok {
+		return
+	}
+
+	hooks, err := d.Store.Webhooks(e.Org, e.Repo)
+	if err != nil {
+		slog.Error("webhooks: listing hooks failed", "org", e.Org, "repo", e.Repo, "err", err)
+		return
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event:     name,
+		Timestamp: e.Time,
+		Org:       e.Org,
+		Repo:      e.Repo,
+		Page:      e.Page,
+		Actor:     e.Actor,
+		Comment:   e.Comment,
+	})
+	if err != nil {
+		slog.Error("webhooks: encoding event failed", "event", name, "err", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Active || !slices.Contains(hook.Events, name) {
+			continue
+		}
+		if err := d.Store.EnqueueDelivery(store.Delivery{WebhookID: hook.ID, Event: name, Payload: string(payload)}); err != nil {
+			slog.Error("webhooks: queueing delivery failed", "event", name, "webhook", hook.ID, "err", err)
+		}
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := d.Store.DueDeliveries(now, batchSize)
+			if err != nil {
+				slog.Error("webhooks: loading due deliveries failed", "err", err)
+				continue
+			}
+			for _, delivery := range due {
+				d.attempt(ctx, delivery)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery store.Delivery) {
+	hook, err := d.Store.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		slog.Error("webhooks: loading hook failed", "webhook", delivery.WebhookID, "err", err)
+		return
+	}
+
+	delivery.Attempts++
+	statusCode, err := d.post(ctx, hook, delivery)
+	delivery.LastStatusCode = statusCode
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		delivery.Status = store.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = store.DeliveryDead
+		delivery.LastError = describe(statusCode, err)
+		slog.Warn("webhooks: delivery dead-lettered", "delivery", delivery.ID, "webhook", hook.ID, "err", err)
+	default:
+		delivery.LastError = describe(statusCode, err)
+		delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+		slog.Info("webhooks: delivery failed", "delivery", delivery.ID, "webhook", hook.ID, "attempt", delivery.Attempts, "err", err)
+	}
+
+	if err := d.Store.UpdateDelivery(delivery); err != nil {
+		slog.Error("webhooks: saving delivery failed", "delivery", delivery.ID, "err", err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, hook store.Webhook, delivery store.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Commentasaurus-Hookshot")
+	req.Header.Set("X-Commentasaurus-Event", delivery.Event)
+	req.Header.Set("X-Commentasaurus-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Commentasaurus-Signature-256", Sign(hook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the value of the X-Commentasaurus-Signature-256 header, the
+// same "sha256=<hex hmac>" scheme GitHub uses for its own webhooks.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff << (attempts - 1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	// Up to 10% jitter so retries against the same endpoint spread out.
+	return wait + rand.N(wait/10+1)
+}
@@ -0,0 +1,195 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/NicholasRucinski/commentasaurus/internal/store"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		want   string
+	}{
+		{
+			// The example from GitHub's "Validating webhook deliveries" docs.
+			name:   "github example",
+			secret: "It's a Secret to Everybody",
+			body:   "Hello, World!",
+			want:   "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		},
+		{
+			// RFC 4231 test case 2.
+			name:   "rfc 4231",
+			secret: "Jefe",
+			body:   "what do ya want for nothing?",
+			want:   "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	// The last attempt dead-letters instead of waiting, so only the ones
+	// before it back off.
+	want := baseBackoff
+	for attempts := 1; attempts < maxAttempts; attempts++ {
+		for range 20 {
+			got := backoff(attempts)
+			if got < want || got > want+want/10 {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempts, got, want, want+want/10)
+			}
+		}
+		want *= 2
+	}
+}
+
+func TestAttemptDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{Store: openStore(t), Client: srv.Client()}
+	hook := createHook(t, d.Store, srv.URL)
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery := onlyDelivery(t, d.Store, hook.ID)
+		if delivery.Status != store.DeliveryPending {
+			t.Fatalf("before attempt %d: status %q, want pending", attempt, delivery.Status)
+		}
+		d.attempt(context.Background(), delivery)
+		// Make the retry due straight away.
+		delivery = onlyDelivery(t, d.Store, hook.ID)
+		delivery.NextAttemptAt = time.Now().Add(-time.Second)
+		if err := d.Store.UpdateDelivery(delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivery := onlyDelivery(t, d.Store, hook.ID)
+	if delivery.Status != store.DeliveryDead || delivery.Attempts != maxAttempts {
+		t.Errorf("after %d attempts: status %q with %d attempts, want dead", maxAttempts, delivery.Status, delivery.Attempts)
+	}
+	if delivery.LastStatusCode != http.StatusBadGateway || delivery.LastError != "endpoint returned 502" {
+		t.Errorf("last status %d, error %q", delivery.LastStatusCode, delivery.LastError)
+	}
+	if due, _ := d.Store.DueDeliveries(time.Now().Add(24*time.Hour), 10); len(due) != 0 {
+		t.Errorf("dead delivery is still due: %+v", due)
+	}
+	if n := calls.Load(); n != maxAttempts {
+		t.Errorf("endpoint called %d times, want %d", n, maxAttempts)
+	}
+}
+
+func TestAttemptRefusesInternalAddress(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	// The hook was created while its host looked public. The dialer still
+	// has to refuse the loopback address it has since resolved to.
+	d := &Dispatcher{Store: openStore(t), Client: newClient()}
+	hook := createHook(t, d.Store, srv.URL)
+	d.attempt(context.Background(), onlyDelivery(t, d.Store, hook.ID))
+
+	delivery, err := d.Store.GetDelivery(onlyDelivery(t, d.Store, hook.ID).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 0 {
+		t.Error("endpoint on loopback was called")
+	}
+	if delivery.LastError != ErrForbiddenAddress.Error() {
+		t.Errorf("last error = %q, want %q", delivery.LastError, ErrForbiddenAddress)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for url, wantErr := range map[string]error{
+		"https://93.184.215.14/hook":      nil,
+		"http://[2606:4700::1111]:8080/":  nil,
+		"http://127.0.0.1:8080/hook":      ErrForbiddenAddress,
+		"http://[::1]/hook":               ErrForbiddenAddress,
+		"http://[::ffff:10.0.0.1]/hook":   ErrForbiddenAddress,
+		"http://169.254.169.254/metadata": ErrForbiddenAddress,
+		"http://192.168.1.20/hook":        ErrForbiddenAddress,
+		"http://0.0.0.0/hook":             ErrForbiddenAddress,
+	} {
+		if err := CheckURL(context.Background(), url); !errors.Is(err, wantErr) {
+			t.Errorf("CheckURL(%q) = %v, want %v", url, err, wantErr)
+		}
+	}
+	for _, url := range []string{"ftp://example.com/", "/relative", "http://"} {
+		if err := CheckURL(context.Background(), url); err == nil {
+			t.Errorf("CheckURL(%q) = nil, want an error", url)
+		}
+	}
+}
+
+func TestDescribeHidesTransportErrors(t *testing.T) {
+	err := &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 5432}, Err: syscall.ECONNREFUSED}
+	if got := describe(0, err); got != "request failed" {
+		t.Errorf("describe(connection refused) = %q", got)
+	}
+	dnsErr := &net.DNSError{Err: "no such host", Name: "billing.internal"}
+	if got := describe(0, dnsErr); strings.Contains(got, "billing") {
+		t.Errorf("describe(dns error) = %q, leaks the host", got)
+	}
+}
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func createHook(t *testing.T, st *store.Store, url string) store.Webhook {
+	t.Helper()
+	hook, err := st.CreateWebhook(store.Webhook{Org: "acme", Repo: "docs", URL: url, Secret: "s", Events: []string{"comment.created"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.EnqueueDelivery(store.Delivery{WebhookID: hook.ID, Event: "comment.created", Payload: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func onlyDelivery(t *testing.T, st *store.Store, webhookID int64) store.Delivery {
+	t.Helper()
+	deliveries, err := st.Deliveries(webhookID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("webhook %d has %d deliveries, want 1", webhookID, len(deliveries))
+	}
+	return deliveries[0]
+}
@@ -0,0 +1,101 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for endpoints on loopback, link-local,
+// private or otherwise internal addresses, which webhooks may not reach.
+var ErrForbiddenAddress = errors.New("url resolves to an internal address")
+
+// CheckURL reports whether rawURL is an http(s) URL whose host only
+// resolves to public addresses. The dispatcher checks the address again
+// when it connects, since DNS can change after a webhook is created.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("can't resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !public(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsPrivate() &&
+		!addr.IsUnspecified()
+}
+
+// dialControl refuses connections to anything but public addresses, whatever
+// the hostname resolved to and however many redirects it took to get there.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !public(addrPort.Addr()) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: dialControl}
+	return &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			// No proxy: the dialer has to see the endpoint's own address.
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// describe turns a failed delivery into the message kept in the delivery
+// log, which org owners can read. Transport errors can name internal hosts
+// and addresses, so only their kind is kept.
+func describe(statusCode int, err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case statusCode != 0:
+		return fmt.Sprintf("endpoint returned %d", statusCode)
+	case errors.Is(err, ErrForbiddenAddress):
+		return ErrForbiddenAddress.Error()
+	case errors.As(err, &dnsErr):
+		return "can't resolve host"
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		return "timed out"
+	default:
+		return "request failed"
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
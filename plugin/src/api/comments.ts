@@ -1,18 +1,26 @@
-import { BaseComment, Comment } from "../types";
+import { BaseComment, Comment, SiteTarget } from "../types";
+
+// siteQuery names the registered site when there is one. Otherwise the
+// server trusts the repo and category IDs from the plugin config.
+export function siteQuery(site: SiteTarget): string {
+  if (site.siteId) {
+    return `site=${encodeURIComponent(site.siteId)}`;
+  }
+  return `category_id=${site.categoryId}&repo_id=${site.repoId}`;
+}
 
 export async function getComments(
   apiUrl: string,
   org: string,
   repoName: string,
-  repoId: string,
-  categoryId: string,
+  site: SiteTarget,
   page: string,
   permissionLevel: string
 ): Promise<{ comments?: Comment[]; error?: string }> {
   try {
     const encodedPage = encodeURIComponent(page);
     const res = await fetch(
-      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?category_id=${categoryId}&repo_id=${repoId}&permission_level=${permissionLevel}`,
+      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?${siteQuery(site)}&permission_level=${permissionLevel}`,
       {
         credentials: "include",
         method: "GET",
@@ -46,15 +54,14 @@ export async function createComment(
   apiUrl: string,
   org: string,
   repoName: string,
-  repoId: string,
-  categoryId: string,
+  site: SiteTarget,
   page: string,
   comment: BaseComment
 ): Promise<{ id?: string; error?: string }> {
   try {
     const encodedPage = encodeURIComponent(page);
     const res = await fetch(
-      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?category_id=${categoryId}&repo_id=${repoId}`,
+      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?${siteQuery(site)}`,
       {
         credentials: "include",
         method: "POST",
@@ -81,15 +88,14 @@ export async function resolveComment(
   apiUrl: string,
   org: string,
   repoName: string,
-  repoId: string,
-  categoryId: string,
+  site: SiteTarget,
   page: string,
   comment: BaseComment
 ): Promise<{ error?: string }> {
   try {
     const encodedPage = encodeURIComponent(page);
     const res = await fetch(
-      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?category_id=${categoryId}&repo_id=${repoId}`,
+      `${apiUrl}/${org}/${repoName}/${encodedPage}/comments?${siteQuery(site)}`,
       {
         credentials: "include",
         method: "PATCH",
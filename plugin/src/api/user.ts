@@ -38,12 +38,14 @@ export async function isUserAllowed(
   repoName: string,
   user: User,
   permissionLevel: CommentPermission,
+  siteId?: string,
 ): Promise<{
   allowed?: boolean;
   error?: string;
 }> {
   try {
-    const res = await fetch(`${apiUrl}/${org}/${repoName}/permissions`, {
+    const query = siteId ? `?site=${encodeURIComponent(siteId)}` : "";
+    const res = await fetch(`${apiUrl}/${org}/${repoName}/permissions${query}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify({
@@ -7,7 +7,10 @@ import { useIsMobile } from "../../hooks/useIsMobile";
 import { isUserAllowed } from "../../api/user";
 import { createComment, getComments, resolveComment } from "../../api/comments";
 import { reanchorComments } from "../../utils/reanchor";
-import { restoreHighlights } from "../../utils/highlights";
+import {
+  restoreHighlights,
+  scrollToLinkedComment,
+} from "../../utils/highlights";
 import CommentsSidebar from "../CommentSidebar";
 import MDXContent from "@theme/MDXContent";
 import styles from "./styles.module.css";
@@ -43,8 +46,9 @@ function DesktopLayout({ children }: Props) {
   } = useComments();
   const [showSide, setShowSidebar] = useState<boolean>(true);
 
-  const { apiUrl, repoOwner, repoName, repoID, repoCategoryId } =
+  const { apiUrl, repoOwner, repoName, repoID, repoCategoryId, siteId } =
     useCommentasaurusConfig();
+  const site = { siteId, repoId: repoID, categoryId: repoCategoryId };
 
   const handleAddComment = useCallback(
     async (draft: BaseComment) => {
@@ -52,8 +56,7 @@ function DesktopLayout({ children }: Props) {
         apiUrl,
         repoOwner,
         repoName,
-        repoID,
-        repoCategoryId,
+        site,
         window.location.pathname,
         draft,
       );
@@ -79,8 +82,7 @@ function DesktopLayout({ children }: Props) {
         apiUrl,
         repoOwner,
         repoName,
-        repoID,
-        repoCategoryId,
+        site,
         window.location.pathname,
         comment,
       );
@@ -218,8 +220,10 @@ function CommentsController({ children }: { children: React.ReactNode }) {
     repoName,
     repoID,
     repoCategoryId,
+    siteId,
     commentPermission,
   } = useCommentasaurusConfig();
+  const site = { siteId, repoId: repoID, categoryId: repoCategoryId };
 
   const [canComment, setCanComment] = useState(false);
   const [canSeeComments, setCanSeeComments] = useState(false);
@@ -237,6 +241,7 @@ function CommentsController({ children }: { children: React.ReactNode }) {
         repoName,
         user,
         commentPermission,
+        siteId,
       );
 
       setCanComment(allowed || false);
@@ -248,8 +253,7 @@ function CommentsController({ children }: { children: React.ReactNode }) {
         apiUrl,
         repoOwner,
         repoName,
-        repoID,
-        repoCategoryId,
+        site,
         window.location.pathname,
         commentPermission,
       );
@@ -261,8 +265,15 @@ function CommentsController({ children }: { children: React.ReactNode }) {
 
   useEffect(() => {
     restoreHighlights(comments);
+    scrollToLinkedComment();
   }, [comments]);
 
+  useEffect(() => {
+    window.addEventListener("hashchange", scrollToLinkedComment);
+    return () =>
+      window.removeEventListener("hashchange", scrollToLinkedComment);
+  }, []);
+
   const value = {
     contentRef,
 
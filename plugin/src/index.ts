@@ -18,6 +18,7 @@ export default function commentasaurusPlugin(
     repoOwner: "",
     repoID: "",
     repoCategoryId: "",
+    siteId: "",
     deleteOnResolve: false,
   };
 
@@ -68,5 +68,14 @@ export interface CommentasaurusConfig {
 	repoOwner?: string;
 	repoID?: string;
 	repoCategoryId?: string;
+	// siteId names a site registered on the server, which then supplies the
+	// repo and category IDs and permission level itself.
+	siteId?: string;
 	deleteOnResolve?: boolean;
 }
+
+export type SiteTarget = {
+	siteId?: string;
+	repoId?: string;
+	categoryId?: string;
+};
@@ -53,8 +53,30 @@ export function restoreHighlights(comments: Comment[]) {
 
 			const span = document.createElement("span");
 			span.setAttribute("data-comment-id", c.id);
+			span.id = commentAnchor(c.id);
 			span.className = styles.highlightedText;
 			range.surroundContents(span);
 		}
 	});
 }
+
+// commentAnchor is the element ID links to a comment use, as in
+// /docs/page#comment-<id>. Notifications link to the thread's top comment.
+export function commentAnchor(id: string) {
+	return `comment-${id}`;
+}
+
+let scrolledTo = "";
+
+// scrollToLinkedComment brings a comment named in the URL hash into view.
+// The highlight only exists once comments have loaded, after the browser
+// has already tried and failed to find the anchor.
+export function scrollToLinkedComment() {
+	const hash = decodeURIComponent(window.location.hash.slice(1));
+	if (!hash.startsWith("comment-") || hash === scrolledTo) return;
+
+	const el = document.getElementById(hash);
+	if (!el) return;
+	scrolledTo = hash;
+	el.scrollIntoView({ behavior: "smooth", block: "center" });
+}